@@ -2,7 +2,6 @@ package api
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -16,6 +15,7 @@ import (
 	"github.com/xackery/talkeq/discord"
 	"github.com/xackery/talkeq/registerdb"
 	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/supervisor"
 	"github.com/xackery/talkeq/tlog"
 )
 
@@ -26,10 +26,12 @@ type API struct {
 	isConnected    bool
 	mutex          sync.RWMutex
 	config         config.API
-	conn           *sql.DB
+	server         *http.Server
 	subscribers    []func(interface{}) error
 	isInitialState bool
 	discord        *discord.Discord
+	supervisor     *supervisor.Supervisor
+	listeners      map[chan request.APIEvent]bool
 }
 
 const (
@@ -46,6 +48,7 @@ func New(ctx context.Context, config config.API, discord *discord.Discord) (*API
 		cancel:         cancel,
 		isInitialState: true,
 		discord:        discord,
+		listeners:      make(map[chan request.APIEvent]bool),
 	}
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
@@ -74,6 +77,24 @@ func (t *API) Subscribe(ctx context.Context, onMessage func(interface{}) error)
 	return nil
 }
 
+// SetConfig swaps in a new configuration.
+// Returns true if the listening address changed and api needs to reconnect for it to apply
+func (t *API) SetConfig(cfg config.API) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	isReconnect := t.config.IsEnabled != cfg.IsEnabled ||
+		t.config.Host != cfg.Host
+	t.config = cfg
+	return isReconnect
+}
+
+// SetSupervisor sets the supervisor endpoint states are reported from on /api/status
+func (t *API) SetSupervisor(s *supervisor.Supervisor) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.supervisor = s
+}
+
 // Command sends a API command
 func (t *API) Command(req request.APICommand) error {
 	ctx := req.Ctx
@@ -155,14 +176,12 @@ func (t *API) Command(req request.APICommand) error {
 			ChannelID: req.FromDiscordChannelID,
 			Message:   fmt.Sprintf("I sent a /tell to %s, you have 2 minutes to go in game and [ accept ] it. Status: In Queue", character),
 		}
-		for _, s := range t.subscribers {
-			err = s(reply)
-			if err != nil {
-				tlog.Warnf("[api->discord] reply to !register: %s", err)
-				continue
-			}
-			tlog.Infof("[api->discord] !register message: %s", reply.Message)
+		// sent directly instead of through subscribers, the message id is needed to edit the status later
+		err = t.discord.Send(reply)
+		if err != nil {
+			return fmt.Errorf("reply to !register: %w", err)
 		}
+		tlog.Infof("[api->discord] !register message: %s", reply.Message)
 		channelID, messageID, err := t.discord.LastSentMessage()
 		if err != nil {
 			return fmt.Errorf("lastSentMessage: %w", err)
@@ -174,7 +193,6 @@ func (t *API) Command(req request.APICommand) error {
 
 // Connect establishes a server for API
 func (t *API) Connect(ctx context.Context) error {
-	var err error
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -185,9 +203,9 @@ func (t *API) Connect(ctx context.Context) error {
 
 	tlog.Infof("[api] listening on %s...", t.config.Host)
 
-	if t.conn != nil {
-		t.conn.Close()
-		t.conn = nil
+	if t.server != nil {
+		t.server.Close()
+		t.server = nil
 		t.cancel()
 	}
 
@@ -197,17 +215,27 @@ func (t *API) Connect(ctx context.Context) error {
 	r.HandleFunc("/api", t.index).Methods("GET")
 	r.HandleFunc("/api/relays", t.relays).Methods("GET")
 	r.HandleFunc("/api/register/confirm", t.registerConfirm).Methods("GET")
+	r.HandleFunc("/api/status", t.status).Methods("GET")
+	r.HandleFunc("/api/events", t.events).Methods("GET")
+	r.HandleFunc("/api/ratelimits", t.rateLimits).Methods("GET")
+
+	t.server = &http.Server{
+		Addr:    t.config.Host,
+		Handler: r,
+	}
 
 	// Start server
-	go func() {
-		err = http.ListenAndServe(t.config.Host, r)
-		if err != nil {
+	go func(server *http.Server) {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
 			tlog.Errorf("[api] listenandserve failed: %s", err)
 		}
 		t.mutex.Lock()
-		t.isConnected = false
+		if t.server == server {
+			t.isConnected = false
+		}
 		t.mutex.Unlock()
-	}()
+	}(t.server)
 
 	t.isConnected = true
 
@@ -227,20 +255,26 @@ func (t *API) IsConnected() bool {
 // Disconnect stops a previously started connection with Discord.
 // If called while a connection is not active, returns nil
 func (t *API) Disconnect(ctx context.Context) error {
-	if !t.config.IsEnabled {
-		tlog.Debugf("[api] is disabled, skipping disconnect")
-		return nil
-	}
-	if !t.isConnected {
+	t.mutex.Lock()
+	// a server that failed to listen is no longer connected, but still has to be closed
+	if t.server == nil {
+		t.mutex.Unlock()
 		tlog.Debugf("[api] is already disconnected, skipping disconnect")
 		return nil
 	}
-	err := t.conn.Close()
+	server := t.server
+	// cancelled first so /api/events streams end, otherwise shutdown waits on them
+	t.cancel()
+	t.server = nil
+	t.isConnected = false
+	t.mutex.Unlock()
+
+	// shutdown waits on handlers, so it can't be called while holding the lock they use
+	err := server.Shutdown(ctx)
 	if err != nil {
-		tlog.Warnf("[api] disconect failed: %s", err)
+		tlog.Warnf("[api] graceful shutdown failed, closing: %s", err)
+		server.Close()
 	}
-	t.conn = nil
-	t.isConnected = false
 	return nil
 }
 
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/tlog"
+)
+
+// Publish sends an event to every client listening on /api/events.
+// Clients that fall behind miss events instead of slowing down relays
+func (t *API) Publish(event request.APIEvent) error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if !t.config.IsEnabled {
+		return fmt.Errorf("API is not enabled")
+	}
+
+	for listener := range t.listeners {
+		select {
+		case listener <- event:
+		default:
+			tlog.Debugf("[api] events listener is full, dropping event from %s", event.Source)
+		}
+	}
+	return nil
+}
+
+// events streams relayed events to the client as server-sent events until it disconnects
+func (t *API) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	listener := make(chan request.APIEvent, 100)
+	t.mutex.Lock()
+	t.listeners[listener] = true
+	ctx := t.ctx
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		delete(t.listeners, listener)
+		t.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ctx.Done():
+			return
+		case event := <-listener:
+			data, err := json.Marshal(event)
+			if err != nil {
+				tlog.Warnf("[api] marshal event failed: %s", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/xackery/talkeq/ratelimit"
+	"github.com/xackery/talkeq/tlog"
+)
+
+// rateLimits reports how often each sender was limited on each route
+func (t *API) rateLimits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	type Resp struct {
+		Counters []ratelimit.Counter `json:"counters"`
+	}
+	resp := Resp{
+		Counters: ratelimit.Counters(),
+	}
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		tlog.Warnf("[api] encode response failed: %s", err)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/xackery/talkeq/supervisor"
+	"github.com/xackery/talkeq/tlog"
+)
+
+func (t *API) status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	type Resp struct {
+		Message   string              `json:"message,omitempty"`
+		Endpoints []supervisor.Status `json:"endpoints"`
+	}
+	resp := Resp{}
+
+	t.mutex.RLock()
+	s := t.supervisor
+	t.mutex.RUnlock()
+	if s == nil {
+		resp.Message = "keep_alive is disabled"
+	} else {
+		resp.Endpoints = s.Status()
+	}
+
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		tlog.Warnf("[api] encode response failed: %s", err)
+	}
+}
@@ -0,0 +1,168 @@
+package auction
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kind is what an offer does with its items
+type Kind string
+
+const (
+	// KindSell is a want to sell offer
+	KindSell Kind = "WTS"
+	// KindBuy is a want to buy offer
+	KindBuy Kind = "WTB"
+	// KindTrade is a want to trade offer
+	KindTrade Kind = "WTT"
+)
+
+var (
+	// keywordRegex matches words that start an offer
+	keywordRegex = regexp.MustCompile(`(?i)\b(WTS|WTB|WTT|selling|buying|trading)\b`)
+	// prefixRegex matches chat that opens with an offer, so "I'm not selling my sword" in ooc stays put
+	prefixRegex = regexp.MustCompile(`(?i)^\W*(WTS|WTB|WTT)\b`)
+	// linkRegex matches item links made by telnet's convertLinks, e.g. [Jboots](<https://...>), https://... (Jboots) or *Jboots*
+	linkRegex = regexp.MustCompile(`\[([^\]]+)\]\(<?[^)>\s]+>?\)|<?(https?://[^\s>]+)>? \(([^)]+)\)|\*([^*]+)\*`)
+	// priceRegex matches a price at the end of an item, e.g. 5k, 500pp or obo
+	priceRegex = regexp.MustCompile(`(?i)\s+(\d+(?:\.\d+)?\s*(?:k|pp|p|plat)?(?:\s+obo)?|obo)$`)
+	// separatorRegex splits items in an offer
+	separatorRegex = regexp.MustCompile(`\s*(?:,|/|\||;|\band\b|\bor\b)\s*`)
+	// placeholderRegex matches a link swapped out while an offer is split
+	placeholderRegex = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// Item is an item mentioned in an offer
+type Item struct {
+	Name string
+	// Link is how the item was linked, e.g. [Jboots](<https://...>), empty if the item was typed
+	Link string
+	// Price is what the item is offered for, e.g. 5k, empty if none was given
+	Price string
+}
+
+// String returns the item's link, or name if it has none, with its price
+func (i Item) String() string {
+	text := i.Name
+	if i.Link != "" {
+		text = i.Link
+	}
+	if i.Price != "" {
+		text += " (" + i.Price + ")"
+	}
+	return text
+}
+
+// Offer is a part of an auction that buys, sells or trades items
+type Offer struct {
+	Kind  Kind
+	Items []Item
+}
+
+// String returns the offer as a single line, e.g. WTS: Jboots (5k), Fungus Covered Scale Tunic
+func (o Offer) String() string {
+	items := []string{}
+	for _, item := range o.Items {
+		items = append(items, item.String())
+	}
+	return fmt.Sprintf("%s: %s", o.Kind, strings.Join(items, ", "))
+}
+
+// Parse classifies message as buying, selling or trading, and returns each offer with the items it mentions.
+// Returns nil if message is not an auction
+func Parse(message string) []Offer {
+	keywords := keywordRegex.FindAllStringSubmatchIndex(message, -1)
+	if len(keywords) == 0 {
+		return nil
+	}
+
+	offers := []Offer{}
+	for i, keyword := range keywords {
+		end := len(message)
+		if i+1 < len(keywords) {
+			end = keywords[i+1][0]
+		}
+		offer := Offer{
+			Kind:  kind(message[keyword[2]:keyword[3]]),
+			Items: items(message[keyword[1]:end]),
+		}
+		offers = append(offers, offer)
+	}
+	return offers
+}
+
+// Convert rewrites a chat line into an auction line if the chat message starts with WTS, WTB or WTT, e.g. ooc into auctions.
+// Words such as selling only count once a message is an auction, everyday chat uses them too.
+// chat must capture the name then the message, and format is the auction line made from them, e.g. %s auctions, '%s'.
+// Returns false if line is not an auction
+func Convert(line string, chat *regexp.Regexp, format string) (string, bool) {
+	matches := chat.FindStringSubmatchIndex(line)
+	if len(matches) < 6 {
+		return line, false
+	}
+	message := line[matches[4]:matches[5]]
+	if !prefixRegex.MatchString(message) {
+		return line, false
+	}
+	name := line[matches[2]:matches[3]]
+	return line[:matches[0]] + fmt.Sprintf(format, name, message) + line[matches[1]:], true
+}
+
+func kind(keyword string) Kind {
+	switch strings.ToLower(keyword) {
+	case "wts", "selling":
+		return KindSell
+	case "wtb", "buying":
+		return KindBuy
+	}
+	return KindTrade
+}
+
+// items splits the text of an offer into items, keeping links intact
+func items(text string) []Item {
+	links := []Item{}
+	text = linkRegex.ReplaceAllStringFunc(text, func(link string) string {
+		matches := linkRegex.FindStringSubmatch(link)
+		name := matches[1]
+		if name == "" {
+			name = matches[3]
+		}
+		if name == "" {
+			name = matches[4]
+		}
+		links = append(links, Item{Name: strings.TrimSpace(name), Link: strings.TrimSpace(link)})
+		return fmt.Sprintf("\x00%d\x00", len(links)-1)
+	})
+
+	items := []Item{}
+	for _, part := range separatorRegex.Split(text, -1) {
+		part = strings.Trim(part, " \t-:.!'\"")
+		if part == "" {
+			continue
+		}
+		item := Item{}
+		price := priceRegex.FindStringSubmatchIndex(part)
+		if price != nil {
+			item.Price = part[price[2]:price[3]]
+			part = strings.TrimSpace(part[:price[0]])
+		}
+		placeholders := placeholderRegex.FindAllStringSubmatch(part, -1)
+		if len(placeholders) == 0 {
+			item.Name = part
+			items = append(items, item)
+			continue
+		}
+		// every link is an item, e.g. WTT [Jboots] for [Mask of Tinkering], and the price goes with the last
+		for i, placeholder := range placeholders {
+			index, _ := strconv.Atoi(placeholder[1])
+			linkItem := links[index]
+			if i == len(placeholders)-1 {
+				linkItem.Price = item.Price
+			}
+			items = append(items, linkItem)
+		}
+	}
+	return items
+}
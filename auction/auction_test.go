@@ -0,0 +1,59 @@
+package auction
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"LFG 55 SK, can tank", nil},
+		{"WTS Jboots 5k, Fungus Covered Scale Tunic 2500pp obo", []string{"WTS: Jboots (5k), Fungus Covered Scale Tunic (2500pp obo)"}},
+		{"selling [Mask of Tinkering](<http://test.com?itemid=1135>) 200p / WTB Mithril Greaves", []string{"WTS: [Mask of Tinkering](<http://test.com?itemid=1135>) (200p)", "WTB: Mithril Greaves"}},
+		{"wtt http://test.com?itemid=1135 (Mask of Tinkering) for *Gold Ring*", []string{"WTT: http://test.com?itemid=1135 (Mask of Tinkering), *Gold Ring*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			offers := Parse(tt.message)
+			if len(offers) != len(tt.want) {
+				t.Fatalf("got %d offers %v, want %d", len(offers), offers, len(tt.want))
+			}
+			for i, offer := range offers {
+				if offer.String() != tt.want[i] {
+					t.Fatalf("offer %d got %q, want %q", i, offer.String(), tt.want[i])
+				}
+			}
+		})
+	}
+
+	offers := Parse("WTS [Mask of Tinkering](<http://test.com?itemid=1135>) 200p")
+	item := offers[0].Items[0]
+	if item.Name != "Mask of Tinkering" || item.Price != "200p" {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	ooc := regexp.MustCompile(`(\w+) says ooc, '(.*)'`)
+	line, ok := Convert("Xackery says ooc, 'WTS Jboots'", ooc, "%s auctions, '%s'")
+	if !ok || line != "Xackery auctions, 'WTS Jboots'" {
+		t.Fatalf("got %q %t", line, ok)
+	}
+	line, ok = Convert("Xackery says ooc, 'hello'", ooc, "%s auctions, '%s'")
+	if ok || line != "Xackery says ooc, 'hello'" {
+		t.Fatalf("got %q %t, wanted a non auction unchanged", line, ok)
+	}
+	for _, message := range []string{"anyone buying a sword? wts", "I'm not selling my Jboots", "trading is slow today"} {
+		line, ok = Convert("Xackery says ooc, '"+message+"'", ooc, "%s auctions, '%s'")
+		if ok {
+			t.Fatalf("got %q, wanted %q left in ooc", line, message)
+		}
+	}
+	line, ok = Convert("Xackery says ooc, '-- wtb Mithril Greaves, selling Jboots'", ooc, "%s auctions, '%s'")
+	if !ok || line != "Xackery auctions, '-- wtb Mithril Greaves, selling Jboots'" {
+		t.Fatalf("got %q %t", line, ok)
+	}
+}
@@ -0,0 +1,215 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/tlog"
+)
+
+// Handler delivers a message to a target endpoint
+type Handler func(ctx context.Context, msg request.Message) error
+
+// Envelope wraps a message travelling on the bus
+type Envelope struct {
+	ID      uint64
+	Source  string
+	Target  string
+	Message request.Message
+	Created time.Time
+	results chan Result
+}
+
+// Result is the outcome of delivering an envelope to every handler of its target
+type Result struct {
+	Envelope *Envelope
+	Handlers int
+	Err      error
+}
+
+// Bus delivers messages from sources to target endpoints.
+// Each target has its own queue, so a slow target does not hold up the others
+type Bus struct {
+	ctx       context.Context
+	mu        sync.RWMutex
+	queues    map[string]*queue
+	queueSize int
+	nextID    uint64
+	inFlight  int
+}
+
+type queue struct {
+	target    string
+	envelopes chan *Envelope
+	mu        sync.RWMutex
+	handlers  []Handler
+}
+
+// New creates a new bus, queueSize is how many messages each target can have pending
+func New(ctx context.Context, queueSize int) *Bus {
+	if queueSize < 1 {
+		queueSize = 100
+	}
+	return &Bus{
+		ctx:       ctx,
+		queues:    make(map[string]*queue),
+		queueSize: queueSize,
+	}
+}
+
+// Handle adds a handler for messages sent to target.
+// Every handler of a target receives every message sent to it, in the order handlers were added
+func (b *Bus) Handle(target string, handler Handler) {
+	b.mu.Lock()
+	q, ok := b.queues[target]
+	if !ok {
+		q = &queue{
+			target:    target,
+			envelopes: make(chan *Envelope, b.queueSize),
+		}
+		b.queues[target] = q
+		go b.loop(q)
+	}
+	b.mu.Unlock()
+
+	q.mu.Lock()
+	q.handlers = append(q.handlers, handler)
+	q.mu.Unlock()
+}
+
+// Publish queues a message for delivery to its destination.
+// The returned channel receives a single result once every handler of the target has been called
+func (b *Bus) Publish(ctx context.Context, source string, msg request.Message) (<-chan Result, error) {
+	if msg == nil {
+		return nil, fmt.Errorf("message is nil")
+	}
+	target := msg.Destination()
+
+	b.mu.Lock()
+	q, ok := b.queues[target]
+	if !ok {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("no handler for target %s", target)
+	}
+	b.nextID++
+	id := b.nextID
+	b.inFlight++
+	b.mu.Unlock()
+
+	env := &Envelope{
+		ID:      id,
+		Source:  source,
+		Target:  target,
+		Message: msg,
+		Created: time.Now(),
+		results: make(chan Result, 1),
+	}
+
+	select {
+	case <-b.ctx.Done():
+		b.done()
+		return nil, fmt.Errorf("bus closed")
+	case <-ctx.Done():
+		b.done()
+		return nil, ctx.Err()
+	default:
+	}
+
+	select {
+	case q.envelopes <- env:
+		return env.results, nil
+	default:
+		b.done()
+		return nil, fmt.Errorf("target %s queue is full", target)
+	}
+}
+
+// Drain blocks until every published message has been delivered, or ctx is done
+func (b *Bus) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		b.mu.RLock()
+		inFlight := b.inFlight
+		b.mu.RUnlock()
+		if inFlight == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d messages still in flight: %w", inFlight, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// done marks a message as no longer in flight
+func (b *Bus) done() {
+	b.mu.Lock()
+	b.inFlight--
+	b.mu.Unlock()
+}
+
+// Pending returns how many messages are waiting to be delivered to target
+func (b *Bus) Pending(target string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	q, ok := b.queues[target]
+	if !ok {
+		return 0
+	}
+	return len(q.envelopes)
+}
+
+func (b *Bus) loop(q *queue) {
+	for {
+		select {
+		case <-b.ctx.Done():
+			tlog.Debugf("[bus] %s queue exiting, context done", q.target)
+			b.discard(q)
+			return
+		case env := <-q.envelopes:
+			env.results <- b.deliver(q, env)
+			b.done()
+		}
+	}
+}
+
+// discard fails every envelope still waiting in q, so Drain isn't left waiting on them
+func (b *Bus) discard(q *queue) {
+	for {
+		select {
+		case env := <-q.envelopes:
+			env.results <- Result{Envelope: env, Err: fmt.Errorf("bus closed")}
+			b.done()
+		default:
+			return
+		}
+	}
+}
+
+func (b *Bus) deliver(q *queue, env *Envelope) Result {
+	q.mu.RLock()
+	handlers := q.handlers
+	q.mu.RUnlock()
+
+	result := Result{
+		Envelope: env,
+		Handlers: len(handlers),
+	}
+	errs := []string{}
+	for i, h := range handlers {
+		err := h(b.ctx, env.Message)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("handler %d: %s", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		result.Err = fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xackery/talkeq/request"
+)
+
+func TestBus_Publish(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := New(ctx, 10)
+
+	got := []string{}
+	b.Handle("telnet", func(ctx context.Context, msg request.Message) error {
+		got = append(got, "first "+msg.(request.TelnetSend).Message)
+		return nil
+	})
+	b.Handle("telnet", func(ctx context.Context, msg request.Message) error {
+		got = append(got, "second "+msg.(request.TelnetSend).Message)
+		return fmt.Errorf("offline")
+	})
+
+	results, err := b.Publish(ctx, "discord", request.TelnetSend{Message: "hello"})
+	if err != nil {
+		t.Fatalf("publish: %s", err)
+	}
+
+	select {
+	case result := <-results:
+		if result.Handlers != 2 {
+			t.Fatalf("handlers wanted 2, got %d", result.Handlers)
+		}
+		if result.Err == nil {
+			t.Fatalf("wanted error from second handler")
+		}
+		if result.Envelope.Source != "discord" || result.Envelope.Target != "telnet" {
+			t.Fatalf("unexpected envelope %+v", result.Envelope)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for result")
+	}
+
+	if len(got) != 2 || got[0] != "first hello" || got[1] != "second hello" {
+		t.Fatalf("unexpected delivery order: %v", got)
+	}
+
+	_, err = b.Publish(ctx, "telnet", request.DiscordSend{Message: "hello"})
+	if err == nil {
+		t.Fatalf("wanted error for target without handlers")
+	}
+}
+
+func TestBus_DrainAfterClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := New(ctx, 10)
+
+	release := make(chan struct{})
+	b.Handle("telnet", func(ctx context.Context, msg request.Message) error {
+		<-release
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		_, err := b.Publish(context.Background(), "discord", request.TelnetSend{Message: fmt.Sprintf("message %d", i)})
+		if err != nil {
+			t.Fatalf("publish %d: %s", i, err)
+		}
+	}
+	cancel()
+	close(release)
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Second)
+	defer drainCancel()
+	err := b.Drain(drainCtx)
+	if err != nil {
+		t.Fatalf("drain: %s", err)
+	}
+}
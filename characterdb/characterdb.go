@@ -2,17 +2,27 @@ package characterdb
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/xackery/talkeq/tlog"
 )
 
-var (
-	characters  = make(map[string]*Character)
+// DB is the list of characters online in a world
+type DB struct {
 	mu          sync.RWMutex
+	characters  map[string]*Character
 	onlineCount int
-)
+	onRefresh   []func()
+}
+
+// New creates a new, empty character database
+func New() *DB {
+	return &DB{
+		characters: make(map[string]*Character),
+	}
+}
 
 // Character represents a character inside EverQuest
 type Character struct {
@@ -24,6 +34,8 @@ type Character struct {
 	Name     string
 	Race     string
 	Zone     string
+	// Guild is the name of the character's guild, empty if they have none
+	Guild    string
 	AcctID   int
 	AcctName string
 	LSID     int
@@ -33,92 +45,131 @@ type Character struct {
 // Characters is an list of character
 type Characters []*Character
 
-// CharactersOnline returns a string of online characters
-func CharactersOnline(filter string) string {
-	mu.RLock()
-	defer mu.RUnlock()
-	content := ""
+// Filter narrows which characters Online returns. Text fields match any part of a character's, ignoring case,
+// and empty fields or a level of 0 match everyone
+type Filter struct {
+	Name     string
+	Zone     string
+	Class    string
+	MinLevel int
+	MaxLevel int
+}
 
-	tlog.Debugf("[characterdb] iterating players (%d total) with filter '%s'", len(characters), filter)
-	totalCount := 0
+// Match returns true if c passes the filter
+func (f Filter) Match(c *Character) bool {
+	if !containsFold(c.Name, f.Name) || !containsFold(c.Zone, f.Zone) || !containsFold(c.Class, f.Class) {
+		return false
+	}
+	if f.MinLevel > 0 && c.Level < f.MinLevel {
+		return false
+	}
+	if f.MaxLevel > 0 && c.Level > f.MaxLevel {
+		return false
+	}
+	return true
+}
+
+// String describes the filter, e.g. zone 'soldungb', level 50-60. Empty if the filter matches everyone
+func (f Filter) String() string {
+	parts := []string{}
+	if f.Name != "" {
+		parts = append(parts, fmt.Sprintf("name '%s'", f.Name))
+	}
+	if f.Zone != "" {
+		parts = append(parts, fmt.Sprintf("zone '%s'", f.Zone))
+	}
+	if f.Class != "" {
+		parts = append(parts, fmt.Sprintf("class '%s'", f.Class))
+	}
+	switch {
+	case f.MinLevel > 0 && f.MaxLevel > 0:
+		parts = append(parts, fmt.Sprintf("level %d-%d", f.MinLevel, f.MaxLevel))
+	case f.MinLevel > 0:
+		parts = append(parts, fmt.Sprintf("level %d+", f.MinLevel))
+	case f.MaxLevel > 0:
+		parts = append(parts, fmt.Sprintf("level %d or lower", f.MaxLevel))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Online returns copies of the online characters that match filter, sorted by name, and how many were hidden for being anonymous or roleplaying
+func (db *DB) Online(filter Filter) (Characters, int) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	tlog.Debugf("[characterdb] iterating players (%d total) with filter %+v", len(db.characters), filter)
+	characters := Characters{}
 	hiddenCount := 0
-	isTruncated := false
-	for _, user := range characters {
-		if totalCount >= 20 {
-			isTruncated = true
-		}
-		if strings.Contains(user.State, "ANON") {
+	for _, c := range db.characters {
+		if strings.Contains(c.State, "ANON") || strings.Contains(c.State, "RolePlay") {
 			hiddenCount++
 			continue
 		}
-		if strings.Contains(user.State, "RolePlay") {
-			hiddenCount++
+		if !filter.Match(c) {
 			continue
 		}
-		/*if user.Status > 0 {
-			hiddenCount++
-			continue
-		}*/
-
-		if filter == "" {
-			content += fmt.Sprintf("%s\n", user.Name)
-			totalCount++
-			continue
-		}
-
-		if !strings.Contains(user.Name, filter) &&
-			!strings.Contains(user.Zone, filter) {
-			continue
-		}
-
-		content += fmt.Sprintf("%s\n", user.Name)
-		totalCount++
-	}
-
-	hiddenText := ""
-	if hiddenCount > 0 {
-		hiddenText = "(%d hidden) "
-	}
-
-	truncatedText := ""
-	if isTruncated {
-		truncatedText = "(truncated) "
-	}
-
-	if totalCount == 0 {
-		content = fmt.Sprintf("There are 0 players %sonline.", hiddenText)
-		return content
-	}
-	if filter == "" {
-		content = fmt.Sprintf("There are %d players %sonline%s:\n%s", totalCount, hiddenText, truncatedText, content)
-		return content
+		character := *c
+		characters = append(characters, &character)
 	}
+	sort.Slice(characters, func(i, j int) bool {
+		return characters[i].Name < characters[j].Name
+	})
+	return characters, hiddenCount
+}
 
-	content = fmt.Sprintf("There are %d players %s%swho match '%s':\n%s", totalCount, hiddenText, truncatedText, filter, content)
-	return content
+// containsFold returns true if s contains substr, ignoring case
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
 
 // SetCharacters sets the character db to provided argument
-func SetCharacters(req map[string]*Character) error {
-	mu.Lock()
-	defer mu.Unlock()
-
-	characters = req
-	onlineCount = len(characters)
-	tlog.Debugf("[characterdb] onlineCount is %d", onlineCount)
+func (db *DB) SetCharacters(req map[string]*Character) error {
+	db.mu.Lock()
+	db.characters = req
+	db.onlineCount = len(db.characters)
+	tlog.Debugf("[characterdb] onlineCount is %d", db.onlineCount)
+	onRefresh := db.onRefresh
+	db.mu.Unlock()
+
+	for _, fn := range onRefresh {
+		fn()
+	}
 	return nil
 }
 
+// OnRefresh adds fn to be called each time SetCharacters refreshes the online characters
+func (db *DB) OnRefresh(fn func()) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.onRefresh = append(db.onRefresh, fn)
+}
+
 // CharactersOnlineCount returns how many characters are reported online
-func CharactersOnlineCount() int {
-	mu.RLock()
-	defer mu.RUnlock()
-	return onlineCount
+func (db *DB) CharactersOnlineCount() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.onlineCount
 }
 
 // SetCharactersOnlineCount sets how many characters are online
-func SetCharactersOnlineCount(value int) {
-	mu.Lock()
-	defer mu.Unlock()
-	onlineCount = value
+func (db *DB) SetCharactersOnlineCount(value int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.onlineCount = value
+}
+
+// Character returns a copy of the online character with name, ignoring case
+func (db *DB) Character(name string) (Character, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	c, ok := db.characters[name]
+	if ok {
+		return *c, true
+	}
+	for _, c := range db.characters {
+		if strings.EqualFold(c.Name, name) {
+			return *c, true
+		}
+	}
+	return Character{}, false
 }
@@ -0,0 +1,45 @@
+package characterdb
+
+import "testing"
+
+func TestDB_Online(t *testing.T) {
+	db := New()
+	db.SetCharacters(map[string]*Character{
+		"Xackery": {Name: "Xackery", Level: 60, Class: "Shadow Knight", Zone: "soldungb"},
+		"Shin":    {Name: "Shin", Level: 52, Class: "Monk", Zone: "soldungb"},
+		"Rogean":  {Name: "Rogean", Level: 60, Class: "Warrior", Zone: "gfaydark"},
+		"Hidden":  {Name: "Hidden", Level: 60, Class: "Rogue", Zone: "soldungb", State: "ANON"},
+	})
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"everyone", Filter{}, []string{"Rogean", "Shin", "Xackery"}},
+		{"zone", Filter{Zone: "SOLDUNGB"}, []string{"Shin", "Xackery"}},
+		{"class", Filter{Class: "shadow"}, []string{"Xackery"}},
+		{"level range", Filter{MinLevel: 55, MaxLevel: 60}, []string{"Rogean", "Xackery"}},
+		{"name and zone", Filter{Name: "x", Zone: "gfay"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			characters, hiddenCount := db.Online(tt.filter)
+			if hiddenCount != 1 {
+				t.Fatalf("got %d hidden, wanted 1", hiddenCount)
+			}
+			names := []string{}
+			for _, c := range characters {
+				names = append(names, c.Name)
+			}
+			if len(names) != len(tt.want) {
+				t.Fatalf("got %v, want %v", names, tt.want)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", names, tt.want)
+				}
+			}
+		})
+	}
+}
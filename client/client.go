@@ -3,44 +3,64 @@ package client
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/xackery/talkeq/api"
+	"github.com/xackery/talkeq/bus"
 	"github.com/xackery/talkeq/config"
 	"github.com/xackery/talkeq/discord"
 	"github.com/xackery/talkeq/eqlog"
 	"github.com/xackery/talkeq/guilddb"
+	"github.com/xackery/talkeq/outbox"
 	"github.com/xackery/talkeq/peqeditorsql"
 	"github.com/xackery/talkeq/request"
 	"github.com/xackery/talkeq/sqlreport"
+	"github.com/xackery/talkeq/supervisor"
 	"github.com/xackery/talkeq/telnet"
 	"github.com/xackery/talkeq/tlog"
 	"github.com/xackery/talkeq/userdb"
 )
 
+const (
+	// outboxRetryInterval is how often messages queued in an outbox are retried while their endpoint is connected
+	outboxRetryInterval = 10 * time.Second
+	// shutdownGrace is how long each endpoint left gets to disconnect once shutdown_timeout is reached
+	shutdownGrace = 2 * time.Second
+)
+
 // Client wraps all talking endpoints
 type Client struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
+	loopCancel   context.CancelFunc
+	mu           sync.RWMutex
 	config       *config.Config
+	bus          *bus.Bus
+	supervisor   *supervisor.Supervisor
+	endpoints    []*endpointEntry
 	discord      *discord.Discord
 	telnet       *telnet.Telnet
 	eqlog        *eqlog.EQLog
 	sqlreport    *sqlreport.SQLReport
 	peqeditorsql *peqeditorsql.PEQEditorSQL
 	api          *api.API
+	// telnetInstances are telnet_instances worlds by name
+	telnetInstances map[string]*telnet.Telnet
 }
 
-// New creates a new client
-func New(ctx context.Context) (*Client, error) {
+// New creates a new client, loading its configuration from configPath
+func New(ctx context.Context, configPath string) (*Client, error) {
 	var err error
 	ctx, cancel := context.WithCancel(ctx)
 	c := Client{
 		ctx:    ctx,
 		cancel: cancel,
+		bus:    bus.New(ctx, 100),
 	}
 	tlog.Debugf("[talkeq] initializing talkeq client")
-	c.config, err = config.NewConfig(ctx)
+	c.config, err = config.NewConfig(ctx, configPath)
 	if err != nil {
 		return nil, fmt.Errorf("config: %w", err)
 	}
@@ -56,62 +76,64 @@ func New(ctx context.Context) (*Client, error) {
 		return nil, fmt.Errorf("guilddb.New: %w", err)
 	}
 
-	tlog.Debugf("[talkeq] initializing 3rd party connections")
-	c.discord, err = discord.New(ctx, c.config.Discord)
-	if err != nil {
-		return nil, fmt.Errorf("discord: %w", err)
-	}
-
-	err = c.discord.Subscribe(ctx, c.onMessage)
-	if err != nil {
-		return nil, fmt.Errorf("discord subscribe: %w", err)
-	}
-
-	c.telnet, err = telnet.New(ctx, c.config.Telnet)
-	if err != nil {
-		return nil, fmt.Errorf("telnet: %w", err)
-	}
-
-	c.sqlreport, err = sqlreport.New(ctx, c.config.SQLReport, c.discord)
-	if err != nil {
-		return nil, fmt.Errorf("sqlreport: %w", err)
-	}
-
-	err = c.telnet.Subscribe(ctx, c.onMessage)
-	if err != nil {
-		return nil, fmt.Errorf("telnet subscribe: %w", err)
-	}
+	tlog.Debugf("[talkeq] initializing endpoints")
+	for _, r := range registry {
+		e, err := r.factory(ctx, &c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.name, err)
+		}
 
-	c.eqlog, err = eqlog.New(ctx, c.config.EQLog)
-	if err != nil {
-		return nil, fmt.Errorf("eqlog: %w", err)
-	}
+		err = e.Subscribe(ctx, c.publisher(r.name))
+		if err != nil {
+			return nil, fmt.Errorf("%s subscribe: %w", r.name, err)
+		}
 
-	err = c.eqlog.Subscribe(ctx, c.onMessage)
-	if err != nil {
-		return nil, fmt.Errorf("eqlog subscribe: %w", err)
+		c.endpoints = append(c.endpoints, &endpointEntry{
+			name:         r.name,
+			isEnabled:    r.isEnabled(c.config),
+			checkEnabled: r.isEnabled,
+			endpoint:     e,
+			reload:       r.reload,
+		})
 	}
 
-	c.peqeditorsql, err = peqeditorsql.New(ctx, c.config.PEQEditor.SQL)
+	err = c.newTelnetInstances(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("peqeditorsql: %w", err)
+		return nil, err
 	}
 
-	err = c.peqeditorsql.Subscribe(ctx, c.onMessage)
-	if err != nil {
-		return nil, fmt.Errorf("peqeditorsql subscribe: %w", err)
+	if c.config.Outbox.IsEnabled {
+		tlog.Debugf("[talkeq] initializing outbox")
+		for _, e := range c.endpoints {
+			service, _ := config.SplitTarget(e.name)
+			switch service {
+			case "discord":
+				e.send = c.sendDiscord
+			case "telnet":
+				e.send = c.sendTelnet
+			default:
+				continue
+			}
+			e.outbox, err = outbox.New(c.config.Outbox.Path, e.name, c.config.Outbox.MaxAgeDuration(), c.config.Outbox.MaxSize)
+			if err != nil {
+				return nil, fmt.Errorf("outbox %s: %w", e.name, err)
+			}
+		}
 	}
 
-	tlog.Debugf("[talkeq] initializing API")
-	c.api, err = api.New(ctx, c.config.API, c.discord)
-	if err != nil {
-		return nil, fmt.Errorf("api subscribe: %w", err)
+	if c.config.IsKeepAliveEnabled {
+		c.supervisor = supervisor.New(supervisor.Config{
+			BaseDelay:       c.config.KeepAliveRetryDuration(),
+			MaxDelay:        c.config.KeepAliveMaxRetryDuration(),
+			MaxFailures:     c.config.KeepAliveMaxFailures,
+			CircuitCooldown: c.config.KeepAliveCircuitCooldownDuration(),
+		})
+		c.api.SetSupervisor(c.supervisor)
 	}
 
-	err = c.api.Subscribe(ctx, c.onMessage)
-	if err != nil {
-		return nil, fmt.Errorf("api subscribe: %w", err)
-	}
+	c.bus.Handle("discord", c.onDiscord)
+	c.bus.Handle("telnet", c.onTelnet)
+	c.bus.Handle("api", c.onAPI)
 
 	return &c, nil
 }
@@ -120,63 +142,80 @@ func New(ctx context.Context) (*Client, error) {
 func (c *Client) Connect(ctx context.Context) error {
 	tlog.Debugf("[talkeq] connecting")
 
-	err := c.discord.Connect(ctx)
-	if err != nil {
-		if !c.config.IsKeepAliveEnabled {
-			return fmt.Errorf("discord connect: %w", err)
+	for _, e := range c.endpoints {
+		err := e.endpoint.Connect(ctx)
+		if err != nil {
+			if c.supervisor == nil {
+				return fmt.Errorf("%s connect: %w", e.name, err)
+			}
+			tlog.Warnf("[%s] connect failed: %s", e.name, err)
+			continue
 		}
-		tlog.Warnf("[discord] connect failed: %s", err)
+		c.replay(e)
 	}
 
-	err = c.telnet.Connect(ctx)
-	if err != nil {
-		if !c.config.IsKeepAliveEnabled {
-			return fmt.Errorf("telnet connect: %w", err)
-		}
-		tlog.Warnf("[telnet] connect failed: %s", err)
-	}
+	loopCtx, loopCancel := context.WithCancel(ctx)
+	c.loopCancel = loopCancel
+	go c.loop(loopCtx)
 
-	err = c.sqlreport.Connect(ctx)
+	err := config.Watch(loopCtx, c.currentConfig().Path(), c.reload)
 	if err != nil {
-		if !c.config.IsKeepAliveEnabled {
-			return fmt.Errorf("sqlreport connect: %w", err)
-		}
-		tlog.Warnf("[sqlreport] connect failed: %s", err)
+		tlog.Warnf("[talkeq] config changes will require a restart, watch failed: %s", err)
 	}
+	return nil
+}
 
-	err = c.eqlog.Connect(ctx)
-	if err != nil {
-		if !c.config.IsKeepAliveEnabled {
-			return fmt.Errorf("eqlog connect: %w", err)
-		}
-		tlog.Warnf("[eqlog] connect failed: %s", err)
-	}
+// currentConfig returns the config in use, which can change when talkeq.conf is reloaded
+func (c *Client) currentConfig() *config.Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config
+}
 
-	err = c.peqeditorsql.Connect(ctx)
-	if err != nil {
-		if !c.config.IsKeepAliveEnabled {
-			return fmt.Errorf("peqeditorsql connect: %w", err)
+// reload applies a changed talkeq.conf. Routes and other settings are swapped in place,
+// and only endpoints whose connection settings changed are reconnected.
+// keep_alive, outbox and database settings still require a restart
+func (c *Client) reload(cfg *config.Config) {
+	tlog.Infof("[talkeq] reloading %s", cfg.Path())
+	c.mu.Lock()
+	c.config = cfg
+	c.mu.Unlock()
+
+	for _, e := range c.endpoints {
+		isReconnect := true
+		if e.reload != nil {
+			isReconnect = e.reload(c, cfg)
 		}
-		tlog.Warnf("[peqeditorsql] connect failed: %s", err)
+		e.setEnabled(e.checkEnabled(cfg))
+		if !isReconnect {
+			continue
+		}
+		tlog.Infof("[%s] connection settings changed, reconnecting", e.name)
+		err := e.endpoint.Disconnect(c.ctx)
+		if err != nil {
+			tlog.Warnf("[%s] disconnect failed: %s", e.name, err)
+		}
+		if !e.IsEnabled() {
+			continue
+		}
+		err = e.endpoint.Connect(c.ctx)
+		if err != nil {
+			tlog.Warnf("[%s] connect failed: %s", e.name, err)
+			continue
+		}
+		c.replay(e)
 	}
-
-	err = c.api.Connect(ctx)
-	if err != nil {
-		if !c.config.IsKeepAliveEnabled {
-			return fmt.Errorf("api connect: %w", err)
+	for _, instance := range cfg.TelnetInstances {
+		if _, ok := c.telnetInstances[instance.Name]; !ok {
+			tlog.Warnf("[telnet:%s] new telnet_instances require a restart to connect", instance.Name)
 		}
-		tlog.Warnf("[api] connect failed: %s", err)
 	}
-
-	go c.loop(ctx)
-	return nil
+	tlog.Infof("[talkeq] reload complete")
 }
 
 func (c *Client) loop(ctx context.Context) {
-	var err error
 	go func() {
 		var err error
-		var online int
 		for {
 			select {
 			case <-ctx.Done():
@@ -184,81 +223,272 @@ func (c *Client) loop(ctx context.Context) {
 				return
 			default:
 			}
-			if c.config.Telnet.IsEnabled && c.config.Discord.IsEnabled {
-				online, err = c.telnet.Who(ctx)
-				if err != nil {
-					tlog.Warnf("[telnet] who failed: %s", err)
-				}
-				err = c.discord.StatusUpdate(ctx, online, "")
-				if err != nil {
-					tlog.Warnf("[discord] status update failed: %s", err)
+			cfg := c.currentConfig()
+			if cfg.Discord.IsEnabled {
+				worlds := c.who(ctx, cfg)
+				if len(worlds) > 0 {
+					err = c.discord.StatusUpdate(ctx, worlds, "")
+					if err != nil {
+						tlog.Warnf("[discord] status update failed: %s", err)
+					}
 				}
 			}
 
 			time.Sleep(60 * time.Second)
 		}
 	}()
-	if !c.config.IsKeepAliveEnabled {
+	// outbox and keep_alive are set up at start, so reloads don't change whether they run
+	go c.replayLoop(ctx)
+	if c.supervisor == nil {
 		tlog.Debugf("[talkeq] keep_alive disabled in config, exiting client loop")
 		return
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			tlog.Debugf("[talkeq] client loop exit, context done")
-			return
-		default:
+	for _, e := range c.endpoints {
+		e := e
+		c.supervisor.Watch(e.name, e, func() { c.replay(e) })
+	}
+	c.supervisor.Run(ctx)
+}
+
+// who asks every enabled telnet world how many players are online
+func (c *Client) who(ctx context.Context, cfg *config.Config) []discord.WorldStatus {
+	worlds := []discord.WorldStatus{}
+	telnets := []*telnet.Telnet{}
+	if cfg.Telnet.IsEnabled {
+		telnets = append(telnets, c.telnet)
+	}
+	for _, instance := range cfg.TelnetInstances {
+		t, ok := c.telnetInstances[instance.Name]
+		if !ok || !instance.IsEnabled {
+			continue
 		}
-		time.Sleep(c.config.KeepAliveRetryDuration())
-		if c.config.Discord.IsEnabled && !c.discord.IsConnected() {
-			tlog.Infof("[discord] attempting to reconnect")
-			err = c.discord.Connect(ctx)
-			if err != nil {
-				tlog.Warnf("[discord] reconnect failed: %s", err)
-			}
+		telnets = append(telnets, t)
+	}
+
+	for _, t := range telnets {
+		online, err := t.Who(ctx)
+		if err != nil {
+			tlog.Warnf("[telnet] %s who failed: %s", t.Name(), err)
 		}
-		if c.config.Telnet.IsEnabled && !c.telnet.IsConnected() {
-			tlog.Infof("[telnet] attempting to reconnect")
-			err = c.telnet.Connect(ctx)
-			if err != nil {
-				tlog.Warnf("[telnet] reconnect failed: %s", err)
-			}
+		worlds = append(worlds, discord.WorldStatus{
+			World:       t.Name(),
+			PlayerCount: online,
+		})
+	}
+	return worlds
+}
+
+// publisher returns a subscriber that publishes messages from source onto the bus
+func (c *Client) publisher(source string) func(interface{}) error {
+	return func(rawReq interface{}) error {
+		msg, ok := rawReq.(request.Message)
+		if !ok {
+			return fmt.Errorf("unknown request type %T", rawReq)
 		}
-		if c.config.SQLReport.IsEnabled && !c.sqlreport.IsConnected() {
-			tlog.Infof("[sqlreport] attempting to reconnect")
-			err = c.sqlreport.Connect(ctx)
-			if err != nil {
-				tlog.Warnf("[sqlreport] connect failed: %s", err)
+		results, err := c.bus.Publish(c.ctx, source, msg)
+		if err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+		go func() {
+			select {
+			case <-c.ctx.Done():
+			case result := <-results:
+				if result.Err != nil {
+					tlog.Warnf("[%s->%s] delivery %d failed: %s", source, result.Envelope.Target, result.Envelope.ID, result.Err)
+				}
 			}
+		}()
+		return nil
+	}
+}
+
+func (c *Client) onDiscord(ctx context.Context, msg request.Message) error {
+	if req, ok := msg.(request.EQLog); ok {
+		msg = request.DiscordSend{
+			Ctx:       req.Ctx,
+			ChannelID: req.ToDiscordChannelID,
+			Message:   req.Message,
 		}
 	}
+	return c.sendParts("discord", msg, c.sendDiscord)
 }
 
-func (c *Client) onMessage(rawReq interface{}) error {
-	var err error
+// sendParts sends each part of a discord message too long for one on its own,
+// so a failure partway through only queues, and later retries, the parts that weren't sent
+func (c *Client) sendParts(target string, msg request.Message, send func(request.Message) error) error {
+	req, ok := msg.(request.DiscordSend)
+	if !ok {
+		return c.send(target, msg, send)
+	}
+	parts := discord.Parts(req)
+	errs := []string{}
+	for i, part := range parts {
+		err := c.send(target, part, send)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("part %d of %d: %s", i+1, len(parts), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
 
-	switch req := rawReq.(type) {
-	case request.APICommand:
-		err = c.api.Command(req)
+func (c *Client) sendDiscord(msg request.Message) error {
+	switch req := msg.(type) {
 	case request.DiscordSend:
-		err = c.discord.Send(req)
+		return c.discord.Send(req)
+	case request.DiscordEdit:
+		return c.discord.EditMessage(req.ChannelID, req.MessageID, req.Message)
+	case request.DiscordDM:
+		return c.discord.SendDM(req)
+	}
+	return fmt.Errorf("unsupported discord request %T", msg)
+}
+
+func (c *Client) onTelnet(ctx context.Context, msg request.Message) error {
+	return c.send(msg.Destination(), msg, c.sendTelnet)
+}
+
+func (c *Client) sendTelnet(msg request.Message) error {
+	switch req := msg.(type) {
 	case request.TelnetSend:
-		err = c.telnet.Send(req)
-	default:
-		return fmt.Errorf("unknown request type")
+		if req.Instance == "" {
+			return c.telnet.Send(req)
+		}
+		t, ok := c.telnetInstances[req.Instance]
+		if !ok {
+			return fmt.Errorf("unknown telnet instance %s", req.Instance)
+		}
+		return t.Send(req)
+	}
+	return fmt.Errorf("unsupported telnet request %T", msg)
+}
+
+// send delivers msg to target, going through the target's outbox if it has one
+func (c *Client) send(target string, msg request.Message, send func(request.Message) error) error {
+	for _, e := range c.endpoints {
+		if e.name != target || e.outbox == nil {
+			continue
+		}
+		return e.outbox.Send(msg, e.endpoint.IsConnected, send)
 	}
+	return send(msg)
+}
+
+// replayLoop retries outbox replays while messages are waiting, since endpoints such as discord
+// can reconnect on their own without the supervisor noticing they were down
+func (c *Client) replayLoop(ctx context.Context) {
+	if !c.hasOutbox() {
+		return
+	}
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			tlog.Debugf("[talkeq] outbox loop exit, context done")
+			return
+		case <-ticker.C:
+		}
+		for _, e := range c.endpoints {
+			if e.outbox == nil || e.outbox.Len() == 0 || !e.endpoint.IsConnected() {
+				continue
+			}
+			c.replay(e)
+		}
+	}
+}
+
+// hasOutbox returns true if any endpoint queues messages while offline
+func (c *Client) hasOutbox() bool {
+	for _, e := range c.endpoints {
+		if e.outbox != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// replay relays any messages queued while an endpoint was offline
+func (c *Client) replay(e *endpointEntry) {
+	if e.outbox == nil || e.outbox.Len() == 0 {
+		return
+	}
+	err := e.outbox.Replay(e.endpoint.IsConnected, e.send)
 	if err != nil {
-		return fmt.Errorf("send: %w", err)
+		tlog.Warnf("[%s] outbox replay stopped: %s", e.name, err)
 	}
-	return nil
 }
 
-// Disconnect attempts to gracefully disconnect all enabled endpoints
+func (c *Client) onAPI(ctx context.Context, msg request.Message) error {
+	switch req := msg.(type) {
+	case request.APICommand:
+		return c.api.Command(req)
+	case request.APIEvent:
+		return c.api.Publish(req)
+	}
+	return fmt.Errorf("unsupported api request %T", msg)
+}
+
+// Disconnect gracefully shuts down every endpoint.
+// Keep alive is stopped first, then endpoints are disconnected in reverse registration order. Before each one,
+// relays still in flight are delivered, so nothing is queued to a closed endpoint and announcements such as
+// the telnet serverdown reach discord. A step that fails or reaches shutdown_timeout doesn't stop the rest,
+// endpoints left are still disconnected, and every failed step is returned as one error
 func (c *Client) Disconnect(ctx context.Context) error {
-	err := c.discord.Disconnect(ctx)
-	if err != nil {
-		return fmt.Errorf("discord: %w", err)
+	ctx, cancel := context.WithTimeout(ctx, c.currentConfig().ShutdownTimeoutDuration())
+	defer cancel()
+	defer c.cancel()
+
+	tlog.Infof("[talkeq] shutting down")
+	if c.loopCancel != nil {
+		c.loopCancel()
 	}
-	c.cancel()
+
+	errs := []string{}
+	for i := len(c.endpoints) - 1; i >= 0; i-- {
+		e := c.endpoints[i]
+		if ctx.Err() == nil {
+			err := c.shutdownStep(ctx, "drain before "+e.name, c.bus.Drain)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		stepCtx := ctx
+		if ctx.Err() != nil {
+			// out of time, but endpoints should still be closed
+			var stepCancel context.CancelFunc
+			stepCtx, stepCancel = context.WithTimeout(context.Background(), shutdownGrace)
+			defer stepCancel()
+		}
+		err := c.shutdownStep(stepCtx, e.name+" disconnect", e.endpoint.Disconnect)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	tlog.Infof("[talkeq] shutdown complete")
 	return nil
 }
+
+// shutdownStep runs fn, giving up once ctx is done
+func (c *Client) shutdownStep(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	tlog.Debugf("[talkeq] shutdown step %s", name)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fn(ctx)
+	}()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			return fmt.Errorf("shutdown step %s: %w", name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown step %s timed out", name)
+	}
+}
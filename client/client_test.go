@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xackery/talkeq/bus"
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/discord"
+	"github.com/xackery/talkeq/outbox"
+	"github.com/xackery/talkeq/request"
+)
+
+// TestClient_reloadRace reloads config while the client loop runs and messages are sent, run with -race
+func TestClient_reloadRace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := discord.New(ctx, config.Discord{})
+	if err != nil {
+		t.Fatalf("discord: %s", err)
+	}
+	c := &Client{
+		ctx:     ctx,
+		cancel:  cancel,
+		config:  &config.Config{},
+		bus:     bus.New(ctx, 10),
+		discord: d,
+	}
+	c.endpoints = append(c.endpoints, &endpointEntry{
+		name:         "discord",
+		endpoint:     d,
+		checkEnabled: func(cfg *config.Config) bool { return cfg.Discord.IsEnabled },
+		reload: func(c *Client, cfg *config.Config) bool {
+			return c.discord.SetConfig(cfg.Discord)
+		},
+	})
+	go c.loop(ctx)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			cfg := &config.Config{IsKeepAliveEnabled: i%2 == 0, ShutdownTimeout: "1s"}
+			cfg.Discord.BotStatus = "EQ"
+			c.reload(cfg)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			c.currentConfig().ShutdownTimeoutDuration()
+			c.send("discord", request.DiscordSend{ChannelID: "1", Message: "hello"}, c.sendDiscord)
+		}
+	}()
+	wg.Wait()
+}
+
+// stubEndpoint is an endpoint whose connection is set by the test
+type stubEndpoint struct {
+	isConnected bool
+}
+
+func (s *stubEndpoint) Connect(ctx context.Context) error    { return nil }
+func (s *stubEndpoint) Disconnect(ctx context.Context) error { return nil }
+func (s *stubEndpoint) IsConnected() bool                    { return s.isConnected }
+func (s *stubEndpoint) Subscribe(ctx context.Context, onMessage func(interface{}) error) error {
+	return nil
+}
+
+func TestClient_sendPartsRetriesUnsent(t *testing.T) {
+	box, err := outbox.New(t.TempDir(), "discord", time.Hour, 10)
+	if err != nil {
+		t.Fatalf("outbox: %s", err)
+	}
+	stub := &stubEndpoint{isConnected: true}
+	c := &Client{}
+	c.endpoints = append(c.endpoints, &endpointEntry{name: "discord", endpoint: stub, outbox: box})
+
+	sent := []string{}
+	isDropped := false
+	send := func(msg request.Message) error {
+		text := msg.(request.DiscordSend).Message
+		// discord drops once, partway through the second part
+		if strings.HasSuffix(text, "(2/3)") && !isDropped {
+			isDropped = true
+			stub.isConnected = false
+			return fmt.Errorf("not connected")
+		}
+		sent = append(sent, text)
+		return nil
+	}
+
+	err = c.sendParts("discord", request.DiscordSend{ChannelID: "1", Message: strings.Repeat("flood ", 900)}, send)
+	if err != nil {
+		t.Fatalf("sendParts: %s", err)
+	}
+	if len(sent) != 1 || box.Len() != 2 {
+		t.Fatalf("sent %d parts and queued %d, wanted 1 sent and the 2 after it queued", len(sent), box.Len())
+	}
+
+	stub.isConnected = true
+	err = box.Replay(stub.IsConnected, send)
+	if err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+	if len(sent) != 3 || !strings.HasSuffix(sent[0], "(1/3)") || !strings.HasSuffix(sent[1], "(2/3)") || !strings.HasSuffix(sent[2], "(3/3)") {
+		t.Fatalf("expected each part sent once in order, got %d parts", len(sent))
+	}
+}
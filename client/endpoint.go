@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/outbox"
+	"github.com/xackery/talkeq/request"
+)
+
+// Endpoint is a service talkeq connects to and relays messages through
+type Endpoint interface {
+	Connect(ctx context.Context) error
+	Disconnect(ctx context.Context) error
+	IsConnected() bool
+	Subscribe(ctx context.Context, onMessage func(interface{}) error) error
+}
+
+// EndpointFactory creates a new endpoint for a client
+type EndpointFactory func(ctx context.Context, c *Client) (Endpoint, error)
+
+// EndpointReloader applies a reloaded config to an endpoint created for a client.
+// Returns true if the endpoint needs to reconnect for the new config to apply
+type EndpointReloader func(c *Client, cfg *config.Config) bool
+
+type registration struct {
+	name      string
+	isEnabled func(cfg *config.Config) bool
+	factory   EndpointFactory
+	reload    EndpointReloader
+}
+
+// endpointEntry is an endpoint created by a client from the registry
+type endpointEntry struct {
+	mu           sync.RWMutex
+	name         string
+	isEnabled    bool
+	checkEnabled func(cfg *config.Config) bool
+	endpoint     Endpoint
+	reload       EndpointReloader
+	outbox       *outbox.Outbox
+	send         func(request.Message) error
+}
+
+// Connect connects the entry's endpoint
+func (e *endpointEntry) Connect(ctx context.Context) error {
+	return e.endpoint.Connect(ctx)
+}
+
+// IsConnected returns if the entry's endpoint is connected
+func (e *endpointEntry) IsConnected() bool {
+	return e.endpoint.IsConnected()
+}
+
+// IsEnabled returns if the entry's endpoint is enabled in the current config
+func (e *endpointEntry) IsEnabled() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.isEnabled
+}
+
+func (e *endpointEntry) setEnabled(isEnabled bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.isEnabled = isEnabled
+}
+
+var registry []registration
+
+// Register adds an endpoint to the registry.
+// Endpoints are created and connected in the order they are registered, and disconnected in reverse order,
+// so an endpoint that others depend on (e.g. discord) should be registered first.
+// reload is called when talkeq.conf changes, and can be nil if the endpoint always reconnects instead
+func Register(name string, isEnabled func(cfg *config.Config) bool, factory EndpointFactory, reload EndpointReloader) {
+	registry = append(registry, registration{
+		name:      name,
+		isEnabled: isEnabled,
+		factory:   factory,
+		reload:    reload,
+	})
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xackery/talkeq/api"
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/discord"
+	"github.com/xackery/talkeq/eqlog"
+	"github.com/xackery/talkeq/peqeditorsql"
+	"github.com/xackery/talkeq/sqlreport"
+	"github.com/xackery/talkeq/telnet"
+	"github.com/xackery/talkeq/tmplfunc"
+)
+
+// built in endpoints, discord is first since sqlreport and api depend on it
+func init() {
+	Register("discord", func(cfg *config.Config) bool { return cfg.Discord.IsEnabled }, func(ctx context.Context, c *Client) (Endpoint, error) {
+		var err error
+		c.discord, err = discord.New(ctx, c.config.Discord)
+		if err != nil {
+			return nil, err
+		}
+		return c.discord, nil
+	}, func(c *Client, cfg *config.Config) bool {
+		return c.discord.SetConfig(cfg.Discord)
+	})
+
+	Register("telnet", func(cfg *config.Config) bool { return cfg.Telnet.IsEnabled }, func(ctx context.Context, c *Client) (Endpoint, error) {
+		var err error
+		c.telnet, err = telnet.New(ctx, c.config.Telnet)
+		if err != nil {
+			return nil, err
+		}
+		return c.telnet, nil
+	}, func(c *Client, cfg *config.Config) bool {
+		return c.telnet.SetConfig(cfg.Telnet)
+	})
+
+	Register("sqlreport", func(cfg *config.Config) bool { return cfg.SQLReport.IsEnabled }, func(ctx context.Context, c *Client) (Endpoint, error) {
+		var err error
+		c.sqlreport, err = sqlreport.New(ctx, c.config.SQLReport, c.discord)
+		if err != nil {
+			return nil, err
+		}
+		return c.sqlreport, nil
+	}, func(c *Client, cfg *config.Config) bool {
+		return c.sqlreport.SetConfig(cfg.SQLReport)
+	})
+
+	Register("eqlog", func(cfg *config.Config) bool { return cfg.EQLog.IsEnabled }, func(ctx context.Context, c *Client) (Endpoint, error) {
+		var err error
+		c.eqlog, err = eqlog.New(ctx, c.config.EQLog)
+		if err != nil {
+			return nil, err
+		}
+		return c.eqlog, nil
+	}, func(c *Client, cfg *config.Config) bool {
+		return c.eqlog.SetConfig(cfg.EQLog)
+	})
+
+	Register("peqeditorsql", func(cfg *config.Config) bool { return cfg.PEQEditor.SQL.IsEnabled }, func(ctx context.Context, c *Client) (Endpoint, error) {
+		var err error
+		c.peqeditorsql, err = peqeditorsql.New(ctx, c.config.PEQEditor.SQL)
+		if err != nil {
+			return nil, err
+		}
+		return c.peqeditorsql, nil
+	}, func(c *Client, cfg *config.Config) bool {
+		return c.peqeditorsql.SetConfig(cfg.PEQEditor.SQL)
+	})
+
+	Register("api", func(cfg *config.Config) bool { return cfg.API.IsEnabled }, func(ctx context.Context, c *Client) (Endpoint, error) {
+		var err error
+		c.api, err = api.New(ctx, c.config.API, c.discord)
+		if err != nil {
+			return nil, err
+		}
+		return c.api, nil
+	}, func(c *Client, cfg *config.Config) bool {
+		return c.api.SetConfig(cfg.API)
+	})
+}
+
+// newTelnetInstances creates an endpoint for each telnet_instances world.
+// Unlike registered endpoints, these are named telnet:<name> after the target discord routes use
+func (c *Client) newTelnetInstances(ctx context.Context) error {
+	c.telnetInstances = make(map[string]*telnet.Telnet)
+	tmplfunc.AddCharacters(c.telnet.Characters())
+	if c.config.Telnet.IsEnabled {
+		c.discord.AddWorld(c.config.Telnet.Name, c.telnet.Characters())
+	}
+
+	for _, instance := range c.config.TelnetInstances {
+		name := instance.Name
+		target := "telnet:" + name
+		t, err := telnet.New(ctx, instance)
+		if err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+		err = t.Subscribe(ctx, c.publisher(target))
+		if err != nil {
+			return fmt.Errorf("%s subscribe: %w", target, err)
+		}
+		c.telnetInstances[name] = t
+		tmplfunc.AddCharacters(t.Characters())
+		if instance.IsEnabled {
+			c.discord.AddWorld(name, t.Characters())
+		}
+
+		c.endpoints = append(c.endpoints, &endpointEntry{
+			name:      target,
+			isEnabled: instance.IsEnabled,
+			checkEnabled: func(cfg *config.Config) bool {
+				instance, _ := cfg.TelnetInstance(name)
+				return instance.IsEnabled
+			},
+			endpoint: t,
+			reload: func(c *Client, cfg *config.Config) bool {
+				// a removed instance gets an empty config, which disables it
+				instance, _ := cfg.TelnetInstance(name)
+				return t.SetConfig(instance)
+			},
+		})
+		c.bus.Handle(target, c.onTelnet)
+	}
+	return nil
+}
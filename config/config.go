@@ -6,10 +6,12 @@ import (
 	"os"
 	"runtime"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/jbsmith7741/toml"
 	"github.com/rs/zerolog"
+	"github.com/xackery/talkeq/split"
 )
 
 // Config represents a configuration parse
@@ -17,65 +19,52 @@ type Config struct {
 	Debug                         bool      `toml:"debug" desc:"TalkEQ Configuration\n\n# Debug messages are displayed. This will cause console to be more verbose, but also more informative"`
 	IsKeepAliveEnabled            bool      `toml:"keep_alive" desc:"Keep all connections alive?\n# If false, endpoint disconnects will not self repair\n# Not recommended to turn off except in advanced cases"`
 	KeepAliveRetry                string    `toml:"keep_alive_retry" desc:"How long before retrying to connect (requires keep_alive = true)\n# default: 10s"`
+	KeepAliveMaxRetry             string    `toml:"keep_alive_max_retry" desc:"Each failed reconnect doubles the wait before the next one, up to this long (requires keep_alive = true)\n# default: 5m"`
+	KeepAliveMaxFailures          int       `toml:"keep_alive_max_failures" desc:"After this many failed reconnects in a row, an endpoint is marked failed and only retried every keep_alive_circuit_cooldown\n# 0 never marks an endpoint failed\n# default: 10"`
+	KeepAliveCircuitCooldown      string    `toml:"keep_alive_circuit_cooldown" desc:"How long a failed endpoint waits before it is retried (requires keep_alive = true)\n# default: 15m"`
+	ShutdownTimeout               string    `toml:"shutdown_timeout" desc:"How long talkeq waits for pending relays and endpoints to close when shutting down\n# default: 30s"`
 	IsFallbackGuildChannelEnabled bool      `toml:"is_fallback_guild_channel_enabled" desc:"If a guild chat occurs and it isn't mapped inside talkeq_guilds, chat is echod to the globalguild channel route channelid"`
 	UsersDatabasePath             string    `toml:"users_database" desc:"Users by ID are mapped to their display names via the raw text file called users database\n# If users database file does not exist, a new one is created\n# This file is actively monitored. if you edit it while talkeq is running, it will reload the changes instantly\n# This file overrides the IGN: playerName role tags in discord\n# If a user is not found on this list, it will fall back to check for IGN tags"`
 	GuildsDatabasePath            string    `toml:"guilds_database" desc:"Guilds by ID are mapped to their database ID via the raw text file called guilds database\n# If guilds database file does not exist, a new one is created\n# This file is actively monitored. if you edit it while talkeq is running, it will reload the changes instantly"`
 	API                           API       `toml:"api" desc:"NOT YET SUPPORTED, can be ignored for now (it's fine to keep enabled): API is a service to allow external tools to talk to TalkEQ via HTTP requests.\n# It uses Restful style (JSON) with a /api suffix for all endpoints"`
 	Discord                       Discord   `toml:"discord" desc:"Discord is a chat service that you can listen and relay EQ chat with"`
 	Telnet                        Telnet    `toml:"telnet" desc:"Telnet is a service eqemu/server can use, that relays messages over"`
+	TelnetInstances               []Telnet  `toml:"telnet_instances" desc:"Optional. Additional telnet worlds, e.g. a test server next to live. Each needs a unique name\n# Discord routes relay to one with a target of telnet:<name>"`
 	EQLog                         EQLog     `toml:"eqlog" desc:"EQ Log is used to parse everquest client logs. Primarily for live EQ, non server owners"`
 	PEQEditor                     PEQEditor `toml:"peq_editor"`
 	SQLReport                     SQLReport `toml:"sql_report" desc:"SQL Report can be used to show stats on discord\n# An ideal way to set this up is create a private voice channel\n# Then bind it to various queries"`
+	Outbox                        Outbox    `toml:"outbox" desc:"Outbox keeps messages for endpoints that are offline, e.g. during a world reboot"`
+	path                          string
 }
 
 // Trigger is a regex pattern matching
 type Trigger struct {
-	Regex        string `toml:"telnet_pattern" desc:"Input telnet trigger regex"`
-	NameIndex    int    `toml:"name_index" desc:"Name is found in this regex index grouping (0 is ignored)"`
-	MessageIndex int    `toml:"message_index" desc:"Message is found in this regex index grouping (0 is ignored)"`
-	GuildIndex   int    `toml:"guild_index" desc:"Guild is found in this regex index grouping (0 is ignored)"`
-	Custom       string `toml:"custom,omitempty" dec:"Custom event defined in code"`
+	Regex          string `toml:"telnet_pattern" desc:"Input telnet trigger regex. Named groups such as (?P<zone>\\w+) are available in message_pattern as {{.Groups.zone}}"`
+	NameIndex      int    `toml:"name_index" desc:"Name is found in this regex index grouping (0 is ignored)"`
+	MessageIndex   int    `toml:"message_index" desc:"Message is found in this regex index grouping (0 is ignored)"`
+	GuildIndex     int    `toml:"guild_index" desc:"Guild is found in this regex index grouping (0 is ignored)"`
+	RecipientIndex int    `toml:"recipient_index" desc:"For a dm target, the character the message is to is found in this regex index grouping, and its registered discord user gets it as a DM"`
+	Custom         string `toml:"custom,omitempty" dec:"Custom event defined in code"`
 }
 
-// NewConfig creates a new configuration
-func NewConfig(ctx context.Context) (*Config, error) {
-	var f *os.File
-	cfg := Config{}
-	path := "talkeq.conf"
-
-	isNewConfig := false
+// NewConfig loads the configuration file at path.
+// If it does not exist, a default one is created and talkeq exits so it can be edited
+func NewConfig(ctx context.Context, path string) (*Config, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return nil, fmt.Errorf("config info: %w", err)
 		}
-		f, err = os.Create(path)
-		if err != nil {
-			return nil, fmt.Errorf("create talkeq.conf: %w", err)
-		}
-		fi, err = os.Stat(path)
+		f, err := os.Create(path)
 		if err != nil {
-			return nil, fmt.Errorf("new config info: %w", err)
+			return nil, fmt.Errorf("create %s: %w", path, err)
 		}
-		isNewConfig = true
-	}
-	if !isNewConfig {
-		f, err = os.Open(path)
-		if err != nil {
-			return nil, fmt.Errorf("open config: %w", err)
-		}
-	}
+		defer f.Close()
 
-	defer f.Close()
-	if fi.IsDir() {
-		return nil, fmt.Errorf("talkeq.conf is a directory, should be a file")
-	}
-
-	if isNewConfig {
 		enc := toml.NewEncoder(f)
 		enc.Encode(getDefaultConfig())
 
-		fmt.Println("a new talkeq.conf file was created. Please open this file and configure talkeq, then run it again.")
+		fmt.Printf("a new %s file was created. Please open this file and configure talkeq, then run it again.\n", path)
 		if runtime.GOOS == "windows" {
 			option := ""
 			fmt.Println("press a key then enter to exit.")
@@ -84,22 +73,55 @@ func NewConfig(ctx context.Context) (*Config, error) {
 		os.Exit(0)
 	}
 
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory, should be a file", path)
+	}
+
+	return Load(path)
+}
+
+// Load decodes and verifies an existing configuration file.
+// TALKEQ_* environment variables and secret files override what is in the file
+func Load(path string) (*Config, error) {
+	cfg, err := Decode(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Verify()
+	if err != nil {
+		return nil, fmt.Errorf("verify: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Decode reads an existing configuration file like Load, without verifying it.
+// Validate can then report every problem, where Verify stops at the first
+func Decode(path string) (*Config, error) {
+	cfg := Config{
+		path: path,
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open config: %w", err)
+	}
+	defer f.Close()
+
 	_, err = toml.DecodeReader(f, &cfg)
 	if err != nil {
-		return nil, fmt.Errorf("decode talkeq.conf: %w", err)
+		return nil, fmt.Errorf("decode %s: %w", path, err)
 	}
 
-	/*fw, err := os.Create("talkeq2.toml")
+	err = cfg.loadSecrets()
 	if err != nil {
-		return nil, fmt.Errorf("talkeq: %w", err)
+		return nil, fmt.Errorf("secrets: %w", err)
 	}
-	defer fw.Close()
 
-	enc := toml.NewEncoder(fw)
-	err = enc.Encode(cfg)
+	err = applyEnv(&cfg, os.LookupEnv)
 	if err != nil {
-		return nil, fmt.Errorf("encode: %w", err)
-	}*/
+		return nil, fmt.Errorf("env: %w", err)
+	}
 
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	if cfg.Debug {
@@ -108,13 +130,36 @@ func NewConfig(ctx context.Context) (*Config, error) {
 	sort.SliceStable(cfg.SQLReport.Entries, func(i, j int) bool {
 		return cfg.SQLReport.Entries[i].Index > cfg.SQLReport.Entries[j].Index
 	})
+	return &cfg, nil
+}
 
-	err = cfg.Verify()
-	if err != nil {
-		return nil, fmt.Errorf("verify: %w", err)
-	}
+// Path returns the file the configuration was loaded from
+func (c *Config) Path() string {
+	return c.path
+}
 
-	return &cfg, nil
+// loadSecrets reads any secrets that are kept in separate files
+func (c *Config) loadSecrets() error {
+	secrets := []struct {
+		key   string
+		path  string
+		value *string
+	}{
+		{"discord.bot_token_file", c.Discord.TokenFile, &c.Discord.Token},
+		{"telnet.password_file", c.Telnet.PasswordFile, &c.Telnet.Password},
+		{"sql_report.password_file", c.SQLReport.PasswordFile, &c.SQLReport.Password},
+	}
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		value, err := readSecret(secret.path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", secret.key, err)
+		}
+		*secret.value = value
+	}
+	return nil
 }
 
 // Verify returns an error if configuration appears off
@@ -131,6 +176,15 @@ func (c *Config) Verify() error {
 	if c.IsKeepAliveEnabled && c.KeepAliveRetryDuration().Seconds() < 2 {
 		c.KeepAliveRetry = "30s"
 	}
+	if c.KeepAliveMaxRetry == "" {
+		c.KeepAliveMaxRetry = "5m"
+	}
+	if c.KeepAliveCircuitCooldown == "" {
+		c.KeepAliveCircuitCooldown = "15m"
+	}
+	if c.ShutdownTimeout == "" {
+		c.ShutdownTimeout = "30s"
+	}
 
 	if err := c.API.Verify(); err != nil {
 		return fmt.Errorf("api: %w", err)
@@ -150,9 +204,117 @@ func (c *Config) Verify() error {
 	if err := c.Telnet.Verify(); err != nil {
 		return fmt.Errorf("telnet: %w", err)
 	}
+	names := map[string]bool{}
+	for i := range c.TelnetInstances {
+		instance := &c.TelnetInstances[i]
+		if instance.Name == "" {
+			return fmt.Errorf("telnet_instances %d: name must be set", i)
+		}
+		if strings.Contains(instance.Name, ":") {
+			return fmt.Errorf("telnet_instances %s: name can't contain ':'", instance.Name)
+		}
+		if names[instance.Name] {
+			return fmt.Errorf("telnet_instances %s: name is used more than once", instance.Name)
+		}
+		names[instance.Name] = true
+		if err := instance.Verify(); err != nil {
+			return fmt.Errorf("telnet_instances %s: %w", instance.Name, err)
+		}
+	}
+	if err := c.Outbox.Verify(); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	if err := c.verifyTargets(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// verifyTargets checks every enabled route relays to a target that exists
+func (c *Config) verifyTargets() error {
+	type source struct {
+		name   string
+		routes []Route
+	}
+	sources := []source{}
+	if c.Telnet.IsEnabled {
+		sources = append(sources, source{"telnet", c.Telnet.Routes})
+	}
+	for _, instance := range c.TelnetInstances {
+		if instance.IsEnabled {
+			sources = append(sources, source{"telnet_instances " + instance.Name, instance.Routes})
+		}
+	}
+	if c.EQLog.IsEnabled {
+		sources = append(sources, source{"eqlog", c.EQLog.Routes})
+	}
+	if c.PEQEditor.IsEnabled && c.PEQEditor.SQL.IsEnabled {
+		sources = append(sources, source{"peqeditor sql", c.PEQEditor.SQL.Routes})
+	}
+	for _, src := range sources {
+		for i, route := range src.routes {
+			if !route.IsEnabled {
+				continue
+			}
+			if err := c.verifyTarget(route.Target); err != nil {
+				return fmt.Errorf("%s: route %d: %w", src.name, i, err)
+			}
+		}
+	}
+
+	if !c.Discord.IsEnabled {
+		return nil
+	}
+	for i, route := range c.Discord.Routes {
+		if !route.IsEnabled {
+			continue
+		}
+		if err := c.verifyTarget(route.Target); err != nil {
+			return fmt.Errorf("discord: route %d: %w", i, err)
+		}
+	}
+	if c.Discord.Tell.IsEnabled {
+		if service, _ := SplitTarget(c.Discord.Tell.Target); service != "telnet" {
+			return fmt.Errorf("discord: tell: target %s is not telnet or telnet:<name>", c.Discord.Tell.Target)
+		}
+		if err := c.verifyTarget(c.Discord.Tell.Target); err != nil {
+			return fmt.Errorf("discord: tell: %w", err)
+		}
+	}
+	return nil
+}
+
+// verifyTarget returns an error if target is not a service talkeq can relay to
+func (c *Config) verifyTarget(target string) error {
+	service, instance := SplitTarget(target)
+	switch service {
+	case "discord", "api", "dm":
+		if instance != "" {
+			return fmt.Errorf("target %s: %s has no instances", target, service)
+		}
+		return nil
+	case "telnet":
+		if instance == "" {
+			return nil
+		}
+		if _, ok := c.TelnetInstance(instance); !ok {
+			return fmt.Errorf("target %s: %s is not a telnet_instances name", target, instance)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown target %s, expected discord, telnet, telnet:<name>, api or dm", target)
+}
+
+// TelnetInstance returns the telnet_instances entry with name
+func (c *Config) TelnetInstance(name string) (Telnet, bool) {
+	for _, instance := range c.TelnetInstances {
+		if instance.Name == name {
+			return instance, true
+		}
+	}
+	return Telnet{}, false
+}
+
 // KeepAliveRetryDuration returns the converted retry rate
 func (c *Config) KeepAliveRetryDuration() time.Duration {
 	retryDuration, err := time.ParseDuration(c.KeepAliveRetry)
@@ -166,13 +328,50 @@ func (c *Config) KeepAliveRetryDuration() time.Duration {
 	return retryDuration
 }
 
+// KeepAliveMaxRetryDuration returns the converted max retry rate
+func (c *Config) KeepAliveMaxRetryDuration() time.Duration {
+	retryDuration, err := time.ParseDuration(c.KeepAliveMaxRetry)
+	if err != nil {
+		return 5 * time.Minute
+	}
+	if retryDuration < c.KeepAliveRetryDuration() {
+		return c.KeepAliveRetryDuration()
+	}
+	return retryDuration
+}
+
+// KeepAliveCircuitCooldownDuration returns the converted circuit cooldown
+func (c *Config) KeepAliveCircuitCooldownDuration() time.Duration {
+	cooldown, err := time.ParseDuration(c.KeepAliveCircuitCooldown)
+	if err != nil {
+		return 15 * time.Minute
+	}
+	if cooldown < c.KeepAliveRetryDuration() {
+		return c.KeepAliveRetryDuration()
+	}
+	return cooldown
+}
+
+// ShutdownTimeoutDuration returns the converted shutdown timeout
+func (c *Config) ShutdownTimeoutDuration() time.Duration {
+	timeout, err := time.ParseDuration(c.ShutdownTimeout)
+	if err != nil || timeout <= 0 {
+		return 30 * time.Second
+	}
+	return timeout
+}
+
 func getDefaultConfig() Config {
 	cfg := Config{
-		Debug:              true,
-		IsKeepAliveEnabled: true,
-		KeepAliveRetry:     "10s",
-		UsersDatabasePath:  "talkeq_users.txt",
-		GuildsDatabasePath: "talkeq_guilds.txt",
+		Debug:                    true,
+		IsKeepAliveEnabled:       true,
+		KeepAliveRetry:           "10s",
+		KeepAliveMaxRetry:        "5m",
+		KeepAliveMaxFailures:     10,
+		KeepAliveCircuitCooldown: "15m",
+		ShutdownTimeout:          "30s",
+		UsersDatabasePath:        "talkeq_users.txt",
+		GuildsDatabasePath:       "talkeq_guilds.txt",
 	}
 	cfg.API.IsEnabled = true
 	cfg.API.Host = ":9933"
@@ -181,6 +380,14 @@ func getDefaultConfig() Config {
 
 	cfg.Discord.IsEnabled = true
 	cfg.Discord.BotStatus = "EQ: {{.PlayerCount}} Online"
+	cfg.Discord.TelnetMaxLength = split.EQMaxLength
+	cfg.Discord.TelnetMaxParts = defaultTelnetMaxParts
+	cfg.Discord.Tell.Target = "telnet"
+	cfg.Discord.Tell.MessagePattern = "tell {{.To}} {{.From}} tells you from discord, '{{.Message}}'"
+	cfg.Discord.RoleSync.Roles = append(cfg.Discord.RoleSync.Roles, DiscordRole{
+		RoleID:   "INSERTLEVEL60ROLEHERE",
+		MinLevel: 60,
+	})
 	cfg.Discord.Routes = append(cfg.Discord.Routes, DiscordRoute{
 		IsEnabled: true,
 		Trigger: DiscordTrigger{
@@ -276,6 +483,18 @@ func getDefaultConfig() Config {
 		MessagePattern: "{{.Name}} **GUILD**: {{.Message}}",
 	})
 
+	// tells to characters of users who opted in with /tells, enable along with [discord.tell]
+	cfg.Telnet.Routes = append(cfg.Telnet.Routes, Route{
+		Trigger: Trigger{
+			Regex:          `(\w+) tells (\w+), '(.*)'`,
+			NameIndex:      1,
+			RecipientIndex: 2,
+			MessageIndex:   3,
+		},
+		Target:         "dm",
+		MessagePattern: "{{.Name}} tells you, '{{.Message}}'",
+	})
+
 	cfg.EQLog.Path = `c:\Program Files\Everquest\Logs\eqlog_CharacterName_Server.txt`
 	cfg.EQLog.Routes = append(cfg.EQLog.Routes, Route{
 		IsEnabled: true,
@@ -337,6 +556,11 @@ func getDefaultConfig() Config {
 	cfg.PEQEditor.SQL.Path = "/var/www/peq/peqphpeditor/logs"
 	cfg.PEQEditor.SQL.FilePattern = "sql_log_{{.Month}}-{{.Year}}.sql"
 
+	cfg.Outbox.IsEnabled = true
+	cfg.Outbox.Path = "talkeq_outbox"
+	cfg.Outbox.MaxAge = "1h"
+	cfg.Outbox.MaxSize = 1000
+
 	cfg.SQLReport.Host = "127.0.0.1:3306"
 	cfg.SQLReport.Username = "eqemu"
 	cfg.SQLReport.Password = "eqemu"
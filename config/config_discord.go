@@ -2,30 +2,129 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"text/template"
+
+	"github.com/xackery/talkeq/split"
+	"github.com/xackery/talkeq/tmplfunc"
 )
 
+// defaultTelnetMaxParts fits a full discord message of 2000 characters in game at the default telnet_max_length, with room for a message_pattern
+const defaultTelnetMaxParts = 5
+
 // Discord represents config settings for discord
 type Discord struct {
-	IsEnabled       bool           `toml:"enabled" desc:"Enable Discord"`
-	Token           string         `toml:"bot_token" desc:"Required. Found at https://discordapp.com/developers/ under your app's bot token area."`
-	ServerID        string         `toml:"server_id" desc:"Required. In Discord, right click the circle button representing your server, and Copy ID, and paste it here."`
-	ClientID        string         `toml:"client_id" desc:"Required. Found at https://discordapp.com/developers/ under your app's general information page, called Application ID"`
-	BotStatus       string         `toml:"bot_status" desc:"Status to show below bot. e.g. \"Playing EQ: 123 Online\"\n# {{.PlayerCount}} to show playercount"`
-	CommandChannels []string       `toml:"command_channels" desc:"Commands are parsed in provided channel ids"`
-	Routes          []DiscordRoute `toml:"routes" desc:"When a message is created in discord, how to route it"`
+	IsEnabled        bool            `toml:"enabled" desc:"Enable Discord"`
+	Token            string          `toml:"bot_token" desc:"Required. Found at https://discordapp.com/developers/ under your app's bot token area."`
+	TokenFile        string          `toml:"bot_token_file,omitempty" desc:"Optional. Reads bot_token from this file instead, e.g. a docker or kubernetes secret"`
+	ServerID         string          `toml:"server_id" desc:"Required. In Discord, right click the circle button representing your server, and Copy ID, and paste it here."`
+	ClientID         string          `toml:"client_id" desc:"Required. Found at https://discordapp.com/developers/ under your app's general information page, called Application ID"`
+	BotStatus        string          `toml:"bot_status" desc:"Status to show below bot. e.g. \"Playing EQ: 123 Online\"\n# {{.PlayerCount}} to show playercount, and {{.World}} for the telnet world's name when there are several"`
+	CommandChannels  []string        `toml:"command_channels" desc:"Commands are parsed in provided channel ids"`
+	Routes           []DiscordRoute  `toml:"routes" desc:"When a message is created in discord, how to route it"`
+	WebhookAvatarURL string          `toml:"webhook_avatar_url" desc:"Optional. Avatar of characters relayed by routes with webhook set, rendered with the online character's {{.Class}}, {{.Race}}, {{.Level}} and {{.Name}}\n# e.g. https://example.com/classes/{{.Class | lower}}.png"`
+	Tell             DiscordTell     `toml:"tell" desc:"Private messages between discord users and characters in game"`
+	RoleSync         DiscordRoleSync `toml:"role_sync" desc:"Give registered users discord roles based on their online character"`
+	TelnetMaxLength  int             `toml:"telnet_max_length" desc:"Longest line relayed in game, longer discord messages are split over several lines marked e.g. (1/3)\n# default: 500"`
+	TelnetMaxParts   int             `toml:"telnet_max_parts" desc:"Most lines one discord message is split into in game, longer messages are not relayed and the sender is told\n# default: 5"`
 }
 
 // DiscordRoute is custom for discord triggering
 type DiscordRoute struct {
 	IsEnabled              bool           `toml:"enabled" desc:"Is route enabled?"`
 	Trigger                DiscordTrigger `toml:"discord_trigger" desc:"condition to trigger route"`
-	Target                 string         `toml:"target" desc:"target service, examples: telnet, discord"`
+	Target                 string         `toml:"target" desc:"target service: discord, telnet, telnet:<name> for a telnet_instances world, or api for the /api/events stream"`
 	ChannelID              string         `toml:"channel_id" desc:"Destination channel ID, For telnet->ooc, set to 260. More values have MT_ prefix in this link: https://docs.eqemu.io/server/operation/chat-channel-types/"`
 	GuildID                string         `toml:"guild_id,omitempty" desc:"Optional, and likely not needed to be set since guilddb file is better, destination guild ID to relay the discord message to"`
 	MessagePattern         string         `toml:"message_pattern" desc:"Destination message in. E.g. {{.Name}} says {{.ChannelName}}, '{{.Message}}"`
 	messagePatternTemplate *template.Template
-	IsAnyoneAllowed        bool `toml:"is_anyone_allowed" desc:"Can anyone use this route? E.g., instead of IGN or a users.txt, anyone given access to provided channel will be able to relay in game using their discord name."`
+	IsAnyoneAllowed        bool          `toml:"is_anyone_allowed" desc:"Can anyone use this route? E.g., instead of IGN or a users.txt, anyone given access to provided channel will be able to relay in game using their discord name."`
+	Filter                 DiscordFilter `toml:"filter" desc:"Optional, rules a message must pass to be relayed"`
+	RateLimit              RateLimit     `toml:"rate_limit" desc:"Optional, flood protection for the route and each sender"`
+}
+
+// DiscordTell is how registered discord users send tells in game with /tell
+type DiscordTell struct {
+	IsEnabled              bool   `toml:"enabled" desc:"Let users registered in the users database send tells in game with /tell, and opt in to tells to their character as DMs with /tells"`
+	Target                 string `toml:"target" desc:"telnet, or telnet:<name> for a telnet_instances world\n# default: telnet"`
+	MessagePattern         string `toml:"message_pattern" desc:"Telnet command that sends the tell.\n# Variables: {{.From}} is the sender's registered character, {{.To}} and {{.Message}}"`
+	messagePatternTemplate *template.Template
+}
+
+// MessagePatternTemplate returns a template for the tell's message pattern
+func (t *DiscordTell) MessagePatternTemplate() *template.Template {
+	if t.messagePatternTemplate == nil {
+		// fallback logic
+		t.messagePatternTemplate, _ = tmplfunc.New("root").Parse(t.MessagePattern)
+	}
+	return t.messagePatternTemplate
+}
+
+// Load is called after config is loaded, and verifies the tell's pattern is valid
+func (t *DiscordTell) Load() error {
+	if !t.IsEnabled {
+		return nil
+	}
+	if t.Target == "" {
+		t.Target = "telnet"
+	}
+	var err error
+	t.messagePatternTemplate, err = tmplfunc.New("root").Parse(t.MessagePattern)
+	if err != nil {
+		return fmt.Errorf("failed to parse: %w", err)
+	}
+	return nil
+}
+
+// DiscordRoleSync gives users in the users database discord roles based on their character each time telnet's who refreshes
+type DiscordRoleSync struct {
+	IsEnabled bool          `toml:"enabled" desc:"Add and remove roles of registered users based on their online character. The bot needs the manage roles permission, and a role above the ones it manages"`
+	Roles     []DiscordRole `toml:"roles" desc:"A role is added if any of its rules match the character, and removed if none do"`
+}
+
+// DiscordRole is a rule for when a character's discord user gets a role. Empty fields or a level of 0 match everyone
+type DiscordRole struct {
+	RoleID   string `toml:"role_id" desc:"In discord, right click the role in server settings and Copy ID"`
+	Class    string `toml:"class,omitempty" desc:"Optional, the character's class, e.g. Shadow Knight"`
+	MinLevel int    `toml:"min_level,omitempty" desc:"Optional, lowest level of the character"`
+	MaxLevel int    `toml:"max_level,omitempty" desc:"Optional, highest level of the character"`
+	GuildID  int    `toml:"guild_id,omitempty" desc:"Optional, ID of the character's guild in the guilds database. The guild's line there needs its name as shown in who, e.g. 12:INSERTCHANNELHERE:Dark Harvest"`
+}
+
+// Verify checks the role sync's rules look valid
+func (r *DiscordRoleSync) Verify() error {
+	if !r.IsEnabled {
+		return nil
+	}
+	for i, role := range r.Roles {
+		if role.RoleID == "" {
+			return fmt.Errorf("role %d: role_id must be set", i)
+		}
+		if role.Class == "" && role.GuildID < 1 && role.MinLevel < 1 && role.MaxLevel < 1 {
+			return fmt.Errorf("role %d: set at least one of class, min_level, max_level or guild_id", i)
+		}
+		if role.MinLevel > 0 && role.MaxLevel > 0 && role.MinLevel > role.MaxLevel {
+			return fmt.Errorf("role %d: min_level %d is above max_level %d", i, role.MinLevel, role.MaxLevel)
+		}
+	}
+	return nil
+}
+
+// Match returns true if a character of class, level and guildID, from the guilds database, gets the role
+func (r DiscordRole) Match(class string, level int, guildID int) bool {
+	if r.Class != "" && !strings.EqualFold(r.Class, class) {
+		return false
+	}
+	if r.GuildID > 0 && r.GuildID != guildID {
+		return false
+	}
+	if r.MinLevel > 0 && level < r.MinLevel {
+		return false
+	}
+	if r.MaxLevel > 0 && level > r.MaxLevel {
+		return false
+	}
+	return true
 }
 
 // DiscordTrigger is custom discord triggering
@@ -38,6 +137,20 @@ func (c *Discord) Verify() error {
 	if !c.IsEnabled {
 		return nil
 	}
+	if c.TelnetMaxLength < 1 {
+		c.TelnetMaxLength = split.EQMaxLength
+	}
+	if c.TelnetMaxParts < 1 {
+		c.TelnetMaxParts = defaultTelnetMaxParts
+	}
+	err := c.Tell.Load()
+	if err != nil {
+		return fmt.Errorf("tell: %w", err)
+	}
+	err = c.RoleSync.Verify()
+	if err != nil {
+		return fmt.Errorf("role_sync: %w", err)
+	}
 
 	for i := range c.Routes {
 		if c.Routes[i].ChannelID == "" {
@@ -47,6 +160,14 @@ func (c *Discord) Verify() error {
 		if err != nil {
 			return fmt.Errorf("route %d: %w", i, err)
 		}
+		err = c.Routes[i].Filter.Load()
+		if err != nil {
+			return fmt.Errorf("route %d filter: %w", i, err)
+		}
+		err = c.Routes[i].RateLimit.Load()
+		if err != nil {
+			return fmt.Errorf("route %d rate_limit: %w", i, err)
+		}
 	}
 	return nil
 }
@@ -56,10 +177,15 @@ func (r *DiscordRoute) MessagePatternTemplate() *template.Template {
 	return r.messagePatternTemplate
 }
 
+// RateLimitKey returns the name the route's rate limits are kept under, e.g. discord.routes[ooc]
+func (r *DiscordRoute) RateLimitKey() string {
+	return fmt.Sprintf("discord.routes[%s]", r.RateLimit.key(r.Trigger.ChannelID, r.Target, r.ChannelID, r.MessagePattern))
+}
+
 // LoadMessagePattern is called after config is loaded, and verified patterns are valid
 func (r *DiscordRoute) LoadMessagePattern() error {
 	var err error
-	r.messagePatternTemplate, err = template.New("root").Parse(r.MessagePattern)
+	r.messagePatternTemplate, err = tmplfunc.New("root").Parse(r.MessagePattern)
 	if err != nil {
 		return fmt.Errorf("failed to parse: %w", err)
 	}
@@ -7,7 +7,7 @@ type EQLog struct {
 	IsEnabled                   bool    `toml:"enabled"`
 	Path                        string  `toml:"path"`
 	Routes                      []Route `toml:"routes" desc:"Routes from EQLog to other services"`
-	IsGeneralChatAuctionEnabled bool    `toml:"convert_general_auction" desc:"convert WTS and WTB messages in general chat to auction channel"`
+	IsGeneralChatAuctionEnabled bool    `toml:"convert_general_auction" desc:"if a general chat message starts with WTS, WTB or WTT, relay it through the auction route instead"`
 }
 
 // Verify checks if config looks valid
@@ -16,10 +16,10 @@ func (c *EQLog) Verify() error {
 		return nil
 	}
 	for i := range c.Routes {
-		if c.Routes[i].ChannelID == "" {
+		if c.Routes[i].ChannelID == "" && c.Routes[i].Target != "dm" {
 			return fmt.Errorf("route %d: invalid channel id", i)
 		}
-		err := c.Routes[i].LoadMessagePattern()
+		err := c.Routes[i].Load()
 		if err != nil {
 			return fmt.Errorf("route %d: %w", i, err)
 		}
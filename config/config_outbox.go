@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Outbox represents config settings for the outbound message queue
+type Outbox struct {
+	IsEnabled bool   `toml:"enabled" desc:"Enable Outbox. When discord or telnet is offline, messages sent to it are stored on disk and relayed in order once it reconnects"`
+	Path      string `toml:"path" desc:"Directory queued messages are stored in, one file per endpoint. Queued messages that fail while the endpoint is connected are moved to its .dead.jsonl file\n# default: talkeq_outbox"`
+	MaxAge    string `toml:"max_age" desc:"Queued messages older than this are discarded instead of relayed\n# default: 1h"`
+	MaxSize   int    `toml:"max_size" desc:"Maximum number of messages queued per endpoint, the oldest are discarded first\n# default: 1000"`
+}
+
+// Verify checks if config looks valid
+func (c *Outbox) Verify() error {
+	if !c.IsEnabled {
+		return nil
+	}
+	if c.Path == "" {
+		c.Path = "talkeq_outbox"
+	}
+	if c.MaxAge == "" {
+		c.MaxAge = "1h"
+	}
+	_, err := time.ParseDuration(c.MaxAge)
+	if err != nil {
+		return fmt.Errorf("max_age %s: %w", c.MaxAge, err)
+	}
+	if c.MaxSize < 1 {
+		c.MaxSize = 1000
+	}
+	return nil
+}
+
+// MaxAgeDuration returns the converted max age
+func (c *Outbox) MaxAgeDuration() time.Duration {
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil {
+		return time.Hour
+	}
+	return maxAge
+}
@@ -29,10 +29,10 @@ func (c *PEQEditor) Verify() error {
 			return fmt.Errorf("sql: file pattern is empty")
 		}
 		for i := range c.SQL.Routes {
-			if c.SQL.Routes[i].ChannelID == "" {
+			if c.SQL.Routes[i].ChannelID == "" && c.SQL.Routes[i].Target != "dm" {
 				return fmt.Errorf("route %d: invalid channel id", i)
 			}
-			err := c.SQL.Routes[i].LoadMessagePattern()
+			err := c.SQL.Routes[i].Load()
 			if err != nil {
 				return fmt.Errorf("route %d: %w", i, err)
 			}
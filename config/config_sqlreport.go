@@ -4,17 +4,20 @@ import (
 	"fmt"
 	"text/template"
 	"time"
+
+	"github.com/xackery/talkeq/tmplfunc"
 )
 
 // SQLReport is used for reporting SQL data to discord
 type SQLReport struct {
-	IsEnabled bool `toml:"enabled"`
-	Host      string
-	Username  string
-	Password  string
-	Database  string
-	Entries   []*SQLReportEntries `toml:"entries"`
-	Routes    []SQLReportRoute    `toml:"routes" desc:"Routes from telnet to other services"`
+	IsEnabled    bool `toml:"enabled"`
+	Host         string
+	Username     string
+	Password     string
+	PasswordFile string `toml:"password_file,omitempty" desc:"Optional. Reads password from this file instead, e.g. a docker or kubernetes secret"`
+	Database     string
+	Entries      []*SQLReportEntries `toml:"entries"`
+	Routes       []SQLReportRoute    `toml:"routes" desc:"Routes from telnet to other services"`
 }
 
 // SQLReportRoute is how to route SQL report messages
@@ -63,7 +66,7 @@ func (c *SQLReport) Verify() error {
 			return fmt.Errorf("duration %s is lower than 30s for sqlreport pattern %s", e.Refresh, e.Pattern)
 		}
 
-		e.PatternTemplate, err = template.New("pattern").Parse(e.Pattern)
+		e.PatternTemplate, err = tmplfunc.New("pattern").Parse(e.Pattern)
 		if err != nil {
 			return fmt.Errorf("parse sqlreport pattern %s: %w", e.Pattern, err)
 		}
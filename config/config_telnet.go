@@ -8,6 +8,7 @@ import (
 // Telnet represents config settings for telnet
 type Telnet struct {
 	IsEnabled               bool    `toml:"enabled" desc:"Enable Telnet"`
+	Name                    string  `toml:"name,omitempty" desc:"Optional. Name of the world, shown in discord /who and bot status. Required for telnet_instances, where discord routes target it as telnet:<name>"`
 	IsLegacy                bool    `toml:"legacy" desc:"EQEMU servers that run 0.8.0 versions need this set to true for item link support, everyone running any newer versions can leave it default (false)"`
 	LinkChunk1Size          int     `toml:"link_chunk1_size" desc:"Size of item links. Can leave at 0, will dynamically detect, Secrets custom is 9. but RoF2 is 6. Titanium is 6. Left for super custom servers."`
 	LinkChunk2Size          int     `toml:"link_chunk2_size" desc:"Size of item links. Can leave at 0, will dynamically detect, Secrets custom is 68. but RoF2 is 50. Titanium is 39. Left for super custom servers."`
@@ -16,11 +17,12 @@ type Telnet struct {
 	Host                    string  `toml:"host" desc:"Address where telnet is found. By default, newer telnet clients will auto success on 127.0.0.1:9000"`
 	Username                string  `toml:"username" desc:"Optional. Username to connect to telnet to. (By default, newer telnet clients will auto succeed if localhost)"`
 	Password                string  `toml:"password" desc:"Optional. Password to connect to telnet to. (By default, newer telnet clients will auto succeed if localhost)"`
+	PasswordFile            string  `toml:"password_file,omitempty" desc:"Optional. Reads password from this file instead, e.g. a docker or kubernetes secret"`
 	Routes                  []Route `toml:"routes" desc:"Routes from telnet to other services"`
 	ItemURL                 string  `toml:"item_url" desc:"Optional. Converts item URLs to provided field. defaults to allakhazam. To disable, change to \n# default: \"http://everquest.allakhazam.com/db/item.html?item=\""`
 	ProfileURL              string  `toml:"profile_url" desc:"Optional. Converts a character's name to a profile URL (e.g. Magelo link). Example: https://retributioneq.com/magelo/index.php?page=character&char= ."`
 	IsServerAnnounceEnabled bool    `toml:"announce_server_status" desc:"Optional. Annunce when a server changes state to OOC channel (Server UP/Down)"`
-	IsOOCAuctionEnabled     bool    `toml:"convert_ooc_auction" desc:"if a OOC message uses prefix WTS or WTB, convert them into auction"`
+	IsOOCAuctionEnabled     bool    `toml:"convert_ooc_auction" desc:"if a OOC message starts with WTS, WTB or WTT, relay it through the auction route instead"`
 }
 
 // TelnetEntry represents telnet event pattern detection
@@ -37,10 +39,10 @@ func (c *Telnet) Verify() error {
 		return nil
 	}
 	for i := range c.Routes {
-		if c.Routes[i].ChannelID == "" {
+		if c.Routes[i].ChannelID == "" && c.Routes[i].Target != "dm" {
 			return fmt.Errorf("route %d: invalid channel id", i)
 		}
-		err := c.Routes[i].LoadMessagePattern()
+		err := c.Routes[i].Load()
 		if err != nil {
 			return fmt.Errorf("route %d: %w", i, err)
 		}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/xackery/talkeq/tmplfunc"
+)
+
+// Embed is how a route to discord renders as an embed. Title, description, author and footer
+// are patterns with the same variables as message_pattern
+type Embed struct {
+	IsEnabled           bool   `toml:"enabled" desc:"Relay to discord as an embed. message_pattern is sent as text above it, and can be empty"`
+	Color               string `toml:"color" desc:"Optional, color of the embed's edge, e.g. #FF9900"`
+	Title               string `toml:"title" desc:"Optional, e.g. Auction"`
+	Description         string `toml:"description" desc:"Body of the embed. Item links are also listed as fields below it\n# default: {{.Message}}"`
+	Author              string `toml:"author" desc:"Shown at the top, and linked to telnet's profile_url if it is set\n# default: {{.Name}}"`
+	Footer              string `toml:"footer" desc:"Shown at the bottom next to the time, e.g. ooc\n# default: the EQ channel captured by a (?P<channel>...) group in the trigger regex, else the route's group, else the source, e.g. telnet"`
+	color               int
+	titleTemplate       *template.Template
+	descriptionTemplate *template.Template
+	authorTemplate      *template.Template
+	footerTemplate      *template.Template
+}
+
+// EmbedText is an embed's patterns rendered for a message
+type EmbedText struct {
+	// Color is the embed's color as a number, 0 if it has none
+	Color       int
+	Title       string
+	Description string
+	Author      string
+	Footer      string
+}
+
+// Load is called after config is loaded, and parses the embed's color and patterns
+func (e *Embed) Load() error {
+	color, err := parseColor(e.Color)
+	if err != nil {
+		return fmt.Errorf("color: %w", err)
+	}
+	e.color = color
+
+	patterns := []struct {
+		key      string
+		pattern  string
+		fallback string
+		tmpl     **template.Template
+	}{
+		{"title", e.Title, "", &e.titleTemplate},
+		{"description", e.Description, "{{.Message}}", &e.descriptionTemplate},
+		{"author", e.Author, "{{.Name}}", &e.authorTemplate},
+		{"footer", e.Footer, "", &e.footerTemplate},
+	}
+	for _, p := range patterns {
+		pattern := p.pattern
+		if pattern == "" {
+			pattern = p.fallback
+		}
+		*p.tmpl, err = tmplfunc.New(p.key).Parse(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.key, err)
+		}
+	}
+	return nil
+}
+
+// Render executes the embed's patterns with data
+func (e *Embed) Render(data RouteMessage) (EmbedText, error) {
+	text := EmbedText{}
+	if e.titleTemplate == nil {
+		// fallback logic
+		err := e.Load()
+		if err != nil {
+			return text, err
+		}
+	}
+	text.Color = e.color
+	patterns := []struct {
+		key  string
+		tmpl *template.Template
+		out  *string
+	}{
+		{"title", e.titleTemplate, &text.Title},
+		{"description", e.descriptionTemplate, &text.Description},
+		{"author", e.authorTemplate, &text.Author},
+		{"footer", e.footerTemplate, &text.Footer},
+	}
+	for _, p := range patterns {
+		buf := new(bytes.Buffer)
+		err := p.tmpl.Execute(buf, data)
+		if err != nil {
+			return text, fmt.Errorf("%s: %w", p.key, err)
+		}
+		*p.out = buf.String()
+	}
+	return text, nil
+}
+
+// parseColor parses a hex color, e.g. #FF9900. An empty color is 0
+func parseColor(color string) (int, error) {
+	if color == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseUint(strings.TrimPrefix(color, "#"), 16, 32)
+	if err != nil || value > 0xFFFFFF {
+		return 0, fmt.Errorf("%s is not a hex color like #FF9900", color)
+	}
+	return int(value), nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is prepended to environment variables that override configuration keys
+const EnvPrefix = "TALKEQ_"
+
+// applyEnv overrides configuration keys with environment variables.
+// A key's variable is its toml path in upper case joined by underscores, e.g. TALKEQ_DISCORD_BOT_TOKEN,
+// and list entries are addressed by index, e.g. TALKEQ_TELNET_ROUTES_0_CHANNEL_ID.
+// Adding a _FILE suffix reads the value from a file instead, e.g. TALKEQ_DISCORD_BOT_TOKEN_FILE=/run/secrets/token
+func applyEnv(c *Config, lookup func(key string) (string, bool)) error {
+	return applyEnvValue(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"), lookup)
+}
+
+func applyEnvValue(v reflect.Value, key string, lookup func(key string) (string, bool)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return applyEnvValue(v.Elem(), key, lookup)
+	case reflect.Struct:
+		// only structs from this package are walked, e.g. time.Time is left alone
+		if v.Type().PkgPath() != reflect.TypeOf(Config{}).PkgPath() {
+			return nil
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldKey := key
+			// embedded structs share their parent's keys, e.g. DiscordFilter's Filter
+			if !field.Anonymous || field.Tag.Get("toml") != "" {
+				name := envFieldName(field)
+				if name == "" {
+					continue
+				}
+				fieldKey = key + "_" + strings.ToUpper(name)
+			}
+			err := applyEnvValue(v.Field(i), fieldKey, lookup)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			err := applyEnvValue(v.Index(i), fmt.Sprintf("%s_%d", key, i), lookup)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	value, ok, err := envValue(key, lookup)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
+
+// envValue returns the value of key, or the contents of the file named by key_FILE
+func envValue(key string, lookup func(key string) (string, bool)) (string, bool, error) {
+	value, ok := lookup(key)
+	if ok {
+		return value, true, nil
+	}
+	path, ok := lookup(key + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	value, err := readSecret(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// envFieldName returns the toml key of a field, or an empty string if it is not decoded
+func envFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("toml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// readSecret returns the contents of a secret file, without surrounding whitespace
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
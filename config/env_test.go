@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(secretPath, []byte("secrettoken\n"), 0600)
+	if err != nil {
+		t.Fatalf("write secret: %s", err)
+	}
+
+	env := map[string]string{
+		"TALKEQ_DEBUG":                              "false",
+		"TALKEQ_KEEP_ALIVE_MAX_FAILURES":            "3",
+		"TALKEQ_DISCORD_BOT_TOKEN_FILE":             secretPath,
+		"TALKEQ_TELNET_HOST":                        "10.0.0.1:9000",
+		"TALKEQ_TELNET_ROUTES_1_CHANNEL_ID":         "12345",
+		"TALKEQ_SQL_REPORT_PASSWORD":                "sqlpass",
+		"TALKEQ_DISCORD_ROUTES_0_FILTER_MIN_LENGTH": "2",
+	}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	cfg := getDefaultConfig()
+	err = applyEnv(&cfg, lookup)
+	if err != nil {
+		t.Fatalf("applyEnv: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"debug", cfg.Debug, false},
+		{"keep_alive_max_failures", cfg.KeepAliveMaxFailures, 3},
+		{"discord.bot_token", cfg.Discord.Token, "secrettoken"},
+		{"telnet.host", cfg.Telnet.Host, "10.0.0.1:9000"},
+		{"telnet.routes.0.channel_id", cfg.Telnet.Routes[0].ChannelID, "INSERTOOCCHANNELHERE"},
+		{"telnet.routes.1.channel_id", cfg.Telnet.Routes[1].ChannelID, "12345"},
+		{"sql_report.password", cfg.SQLReport.Password, "sqlpass"},
+		{"discord.routes.0.filter.min_length", cfg.Discord.Routes[0].Filter.MinLength, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Fatalf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	env = map[string]string{"TALKEQ_DEBUG": "maybe"}
+	err = applyEnv(&cfg, lookup)
+	if err == nil {
+		t.Fatalf("expected error for invalid bool")
+	}
+}
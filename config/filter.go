@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Filter is a set of rules a route's message must pass before it is relayed. Rules left empty are not checked
+type Filter struct {
+	Exclude        []string `toml:"exclude" desc:"Skip messages matching any of these regexes, e.g. ^! to skip bot commands"`
+	AllowNames     []string `toml:"allow_names" desc:"Only relay messages from these names"`
+	DenyNames      []string `toml:"deny_names" desc:"Never relay messages from these names, e.g. bot characters or GM alts"`
+	MinLength      int      `toml:"min_length" desc:"Skip messages shorter than this many characters, 0 is no minimum"`
+	MaxLength      int      `toml:"max_length" desc:"Skip messages longer than this many characters, 0 is no maximum"`
+	excludeRegexes []*regexp.Regexp
+}
+
+// DiscordFilter is a Filter with rules for who sent a discord message
+type DiscordFilter struct {
+	Filter
+	AllowUsers    []string `toml:"allow_users" desc:"Only relay messages from these discord user IDs"`
+	DenyUsers     []string `toml:"deny_users" desc:"Never relay messages from these discord user IDs"`
+	RequiredRoles []string `toml:"required_roles" desc:"Only relay messages from discord users with at least one of these role names or IDs"`
+}
+
+// Load compiles exclude regexes and checks lengths, it is called after config is loaded
+func (f *Filter) Load() error {
+	f.excludeRegexes = []*regexp.Regexp{}
+	for _, exclude := range f.Exclude {
+		pattern, err := regexp.Compile(exclude)
+		if err != nil {
+			return fmt.Errorf("exclude %q: %w", exclude, err)
+		}
+		f.excludeRegexes = append(f.excludeRegexes, pattern)
+	}
+	if f.MinLength < 0 {
+		return fmt.Errorf("min_length %d is negative", f.MinLength)
+	}
+	if f.MaxLength < 0 {
+		return fmt.Errorf("max_length %d is negative", f.MaxLength)
+	}
+	if f.MaxLength > 0 && f.MinLength > f.MaxLength {
+		return fmt.Errorf("min_length %d is more than max_length %d", f.MinLength, f.MaxLength)
+	}
+	return nil
+}
+
+// Check returns why a message from name is filtered, or nil if it passes
+func (f *Filter) Check(name string, message string) error {
+	if f.excludeRegexes == nil {
+		// fallback logic, same as MessagePatternTemplate
+		err := f.Load()
+		if err != nil {
+			return err
+		}
+	}
+	if len(f.AllowNames) > 0 && !containsFold(f.AllowNames, name) {
+		return fmt.Errorf("name %q is not in allow_names", name)
+	}
+	if containsFold(f.DenyNames, name) {
+		return fmt.Errorf("name %q is in deny_names", name)
+	}
+	length := utf8.RuneCountInString(message)
+	if length < f.MinLength {
+		return fmt.Errorf("message length %d is under min_length %d", length, f.MinLength)
+	}
+	if f.MaxLength > 0 && length > f.MaxLength {
+		return fmt.Errorf("message length %d is over max_length %d", length, f.MaxLength)
+	}
+	for i, pattern := range f.excludeRegexes {
+		if pattern.MatchString(message) {
+			return fmt.Errorf("message matches exclude %q", f.Exclude[i])
+		}
+	}
+	return nil
+}
+
+// CheckUser returns why a message from a discord user with roles is filtered, or nil if it passes.
+// roles can be a mix of role names and IDs
+func (f *DiscordFilter) CheckUser(userID string, roles []string) error {
+	if len(f.AllowUsers) > 0 && !containsFold(f.AllowUsers, userID) {
+		return fmt.Errorf("user %s is not in allow_users", userID)
+	}
+	if containsFold(f.DenyUsers, userID) {
+		return fmt.Errorf("user %s is in deny_users", userID)
+	}
+	if len(f.RequiredRoles) == 0 {
+		return nil
+	}
+	for _, role := range roles {
+		if containsFold(f.RequiredRoles, role) {
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s has none of required_roles", userID)
+}
+
+// containsFold returns true if values has value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestFilter_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  Filter
+		who     string
+		message string
+		wantErr bool
+	}{
+		{name: "empty", filter: Filter{}, who: "Xackery", message: "hello"},
+		{name: "allowed", filter: Filter{AllowNames: []string{"xackery"}}, who: "Xackery", message: "hello"},
+		{name: "not allowed", filter: Filter{AllowNames: []string{"Shin"}}, who: "Xackery", message: "hello", wantErr: true},
+		{name: "denied", filter: Filter{DenyNames: []string{"Xackery"}}, who: "Xackery", message: "hello", wantErr: true},
+		{name: "excluded", filter: Filter{Exclude: []string{`^!`}}, who: "Xackery", message: "!who", wantErr: true},
+		{name: "not excluded", filter: Filter{Exclude: []string{`^!`}}, who: "Xackery", message: "who!"},
+		{name: "too short", filter: Filter{MinLength: 6}, who: "Xackery", message: "hello", wantErr: true},
+		{name: "too long", filter: Filter{MaxLength: 4}, who: "Xackery", message: "hello", wantErr: true},
+		{name: "bad exclude", filter: Filter{Exclude: []string{`(`}}, who: "Xackery", message: "hello", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Check(tt.who, tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Filter.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiscordFilter_CheckUser(t *testing.T) {
+	f := DiscordFilter{
+		DenyUsers:     []string{"2"},
+		RequiredRoles: []string{"Member"},
+	}
+	if err := f.CheckUser("1", []string{"100", "member"}); err != nil {
+		t.Fatalf("expected role name to pass: %s", err)
+	}
+	if err := f.CheckUser("1", []string{"100"}); err == nil {
+		t.Fatalf("expected missing role to fail")
+	}
+	if err := f.CheckUser("2", []string{"member"}); err == nil {
+		t.Fatalf("expected denied user to fail")
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// RateLimitDrop discards limited messages
+	RateLimitDrop = "drop"
+	// RateLimitQueue holds limited messages until the limit allows them, up to max_queue
+	RateLimitQueue = "queue"
+	// RateLimitNotify discards limited messages and tells the discord sender
+	RateLimitNotify = "notify"
+)
+
+// RateLimit protects a route from floods. Limits left at 0 are not checked
+type RateLimit struct {
+	Name            string `toml:"name,omitempty" desc:"Optional, names the route in /api/ratelimits. Routes with the same name share route limits\n# default: a hash of the route's trigger, target, channel and message pattern"`
+	RoutePerMinute  int    `toml:"route_per_minute" desc:"Messages the route relays per minute, 0 is unlimited"`
+	RouteBurst      int    `toml:"route_burst" desc:"Messages the route can relay at once before route_per_minute applies, 0 is the same as route_per_minute"`
+	SenderPerMinute int    `toml:"sender_per_minute" desc:"Messages each sender can relay through the route per minute, 0 is unlimited"`
+	SenderBurst     int    `toml:"sender_burst" desc:"Messages each sender can relay at once before sender_per_minute applies, 0 is the same as sender_per_minute"`
+	DuplicateWindow string `toml:"duplicate_window" desc:"Skip a sender repeating the same message within this long, e.g. 30s. Empty is off"`
+	Action          string `toml:"action" desc:"What happens to a limited message: drop, queue to relay it once the limit allows, or notify to drop it and tell the discord sender\n# default: drop"`
+	MaxQueue        int    `toml:"max_queue" desc:"Messages that can wait for the route when action is queue, more are dropped\n# default: 10"`
+}
+
+// Load checks the rate limit and sets defaults, it is called after config is loaded
+func (r *RateLimit) Load() error {
+	if r.RoutePerMinute < 0 || r.RouteBurst < 0 || r.SenderPerMinute < 0 || r.SenderBurst < 0 {
+		return fmt.Errorf("limits can't be negative")
+	}
+	if r.DuplicateWindow != "" {
+		_, err := time.ParseDuration(r.DuplicateWindow)
+		if err != nil {
+			return fmt.Errorf("duplicate_window %s: %w", r.DuplicateWindow, err)
+		}
+	}
+	if r.Action == "" {
+		r.Action = RateLimitDrop
+	}
+	switch r.Action {
+	case RateLimitDrop, RateLimitQueue, RateLimitNotify:
+	default:
+		return fmt.Errorf("action %s must be drop, queue or notify", r.Action)
+	}
+	if r.MaxQueue < 1 {
+		r.MaxQueue = 10
+	}
+	return nil
+}
+
+// IsEnabled returns true if any limit is set
+func (r *RateLimit) IsEnabled() bool {
+	return r.RoutePerMinute > 0 || r.SenderPerMinute > 0 || r.DuplicateWindow != ""
+}
+
+// DuplicateWindowDuration returns the converted duplicate window, 0 if it is off
+func (r *RateLimit) DuplicateWindowDuration() time.Duration {
+	window, err := time.ParseDuration(r.DuplicateWindow)
+	if err != nil {
+		return 0
+	}
+	return window
+}
+
+// key returns a stable name for a route's limits, so they stay with the route when a reload reorders routes.
+// parts describe the route, and are hashed if the limit has no name
+func (r *RateLimit) key(parts ...string) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:4])
+}
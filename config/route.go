@@ -2,38 +2,174 @@ package config
 
 import (
 	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
 	"text/template"
+
+	"github.com/xackery/talkeq/auction"
+	"github.com/xackery/talkeq/tmplfunc"
 )
 
 // Route is how to route telnet messages
 type Route struct {
-	IsEnabled              bool    `toml:"enabled" desc:"Is route enabled?"`
-	Trigger                Trigger `toml:"trigger" desc:"condition to trigger route"`
-	Target                 string  `toml:"target" desc:"target service, e.g. telnet"`
-	ChannelID              string  `toml:"channel_id" desc:"Destination channel ID"`
-	GuildID                string  `toml:"guild_id,omitempty" desc:"Optional, Destination guild ID"`
-	MessagePattern         string  `toml:"message_pattern" desc:"Destination message in. E.g. {{.Name}} says {{.ChannelName}}, '{{.Message}}"`
+	IsEnabled              bool      `toml:"enabled" desc:"Is route enabled?"`
+	Trigger                Trigger   `toml:"trigger" desc:"condition to trigger route"`
+	Target                 string    `toml:"target" desc:"target service: discord, telnet, telnet:<name> for a telnet_instances world, api for the /api/events stream, or dm to DM the discord user registered to the character in recipient_index"`
+	ChannelID              string    `toml:"channel_id" desc:"Destination channel ID"`
+	GuildID                string    `toml:"guild_id,omitempty" desc:"Optional, Destination guild ID"`
+	MessagePattern         string    `toml:"message_pattern" desc:"Destination message in. E.g. {{.Name}} says {{.ChannelName}}, '{{.Message}}\n# Variables: {{.Name}}, {{.Message}}, {{.Raw}} for the whole matched line, {{.Groups.<name>}} for named regex groups, and {{range .Offers}}{{.}}{{end}} for auction offers"`
+	Filter                 Filter    `toml:"filter" desc:"Optional, rules a message must pass to be relayed"`
+	RateLimit              RateLimit `toml:"rate_limit" desc:"Optional, flood protection for the route and each sender"`
+	Priority               int       `toml:"priority" desc:"Routes with a higher priority are checked first, routes with the same priority are checked in order\n# default: 0"`
+	IsStop                 bool      `toml:"stop" desc:"Stop checking other routes once this route matches, e.g. so a WTS route takes over from a catch-all ooc route"`
+	Group                  string    `toml:"group" desc:"Optional, only the first matching route of a group relays, e.g. set group = \"ooc\" on a WTS route and an ooc route"`
+	Embed                  Embed     `toml:"embed" desc:"Optional, relay to discord as an embed"`
+	IsWebhook              bool      `toml:"webhook" desc:"Relay to discord through a channel webhook, so messages appear from the character's name, with discord's webhook_avatar_url.\n# message_pattern can then leave the name out, e.g. {{.Message}}. The bot needs the manage webhooks permission"`
+	IsMarkdownAllowed      bool      `toml:"allow_markdown" desc:"Discord targets escape markdown and mentions in names and messages, so only the message pattern formats. Set true to relay them as typed, e.g. when the pattern wraps the message in a code block"`
 	messagePatternTemplate *template.Template
+	triggerRegex           *regexp.Regexp
+	triggerLiteral         string
+}
+
+// RouteMessage is the data a route's message pattern is rendered with
+type RouteMessage struct {
+	Name    string
+	Message string
+	// Raw is the whole line the route matched
+	Raw string
+	// Groups has every named group of the trigger regex, e.g. {{.Groups.zone}} for (?P<zone>\w+)
+	Groups map[string]string
+}
+
+// Offers returns what the message buys, sells or trades, e.g. {{range .Offers}}{{.}}{{end}} renders WTS: Jboots (5k).
+// Empty if the message is not an auction
+func (m RouteMessage) Offers() []auction.Offer {
+	return auction.Parse(m.Message)
 }
 
 // MessagePatternTemplate returns a template for provided route
 func (r *Route) MessagePatternTemplate() *template.Template {
 	if r.messagePatternTemplate == nil {
 		// fallback logic
-		r.messagePatternTemplate, _ = template.New("root").Parse(r.MessagePattern)
+		r.messagePatternTemplate, _ = tmplfunc.New("root").Parse(r.MessagePattern)
 	}
 	return r.messagePatternTemplate
 }
 
+// RateLimitKey returns the name the route's rate limits are kept under, e.g. telnet.routes[ooc] for source telnet
+func (r *Route) RateLimitKey(source string) string {
+	return fmt.Sprintf("%s.routes[%s]", source, r.RateLimit.key(r.Trigger.Regex, r.Trigger.Custom, r.Target, r.ChannelID, r.MessagePattern))
+}
+
 // LoadMessagePattern is called after config is loaded, and verified patterns are valid
 func (r *Route) LoadMessagePattern() error {
 	if !r.IsEnabled {
 		return nil
 	}
 	var err error
-	r.messagePatternTemplate, err = template.New("root").Parse(r.MessagePattern)
+	r.messagePatternTemplate, err = tmplfunc.New("root").Parse(r.MessagePattern)
 	if err != nil {
 		return fmt.Errorf("failed to parse: %w", err)
 	}
 	return nil
 }
+
+// Load is called after config is loaded, and prepares the route for matching
+func (r *Route) Load() error {
+	err := r.LoadMessagePattern()
+	if err != nil {
+		return err
+	}
+	err = r.LoadTrigger()
+	if err != nil {
+		return fmt.Errorf("trigger: %w", err)
+	}
+	err = r.Filter.Load()
+	if err != nil {
+		return fmt.Errorf("filter: %w", err)
+	}
+	err = r.RateLimit.Load()
+	if err != nil {
+		return fmt.Errorf("rate_limit: %w", err)
+	}
+	if r.Embed.IsEnabled {
+		err = r.Embed.Load()
+		if err != nil {
+			return fmt.Errorf("embed: %w", err)
+		}
+	}
+	return nil
+}
+
+// TriggerRegex returns the compiled trigger regex, or nil for a custom trigger or a regex that doesn't compile
+func (r *Route) TriggerRegex() *regexp.Regexp {
+	if r.triggerRegex == nil && r.Trigger.Custom == "" {
+		// fallback logic
+		r.LoadTrigger()
+	}
+	return r.triggerRegex
+}
+
+// TriggerLiteral returns text every line matching the trigger regex contains, e.g. " says ooc, '".
+// Lines without it can skip the regex. Empty if the regex has no such text
+func (r *Route) TriggerLiteral() string {
+	if r.triggerRegex == nil && r.Trigger.Custom == "" {
+		// fallback logic
+		r.LoadTrigger()
+	}
+	return r.triggerLiteral
+}
+
+// LoadTrigger compiles the trigger regex, so lines are matched without compiling it each time
+func (r *Route) LoadTrigger() error {
+	if !r.IsEnabled || r.Trigger.Custom != "" {
+		return nil
+	}
+	var err error
+	r.triggerRegex, err = regexp.Compile(r.Trigger.Regex)
+	if err != nil {
+		return fmt.Errorf("compile %q: %w", r.Trigger.Regex, err)
+	}
+	r.triggerLiteral = ""
+	tree, err := syntax.Parse(r.Trigger.Regex, syntax.Perl)
+	if err == nil {
+		r.triggerLiteral = requiredLiteral(tree.Simplify())
+	}
+	return nil
+}
+
+// requiredLiteral returns the longest case sensitive text any match of re has to contain
+func requiredLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return ""
+		}
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return ""
+		}
+		return requiredLiteral(re.Sub[0])
+	case syntax.OpConcat:
+		literal := ""
+		for _, sub := range re.Sub {
+			subLiteral := requiredLiteral(sub)
+			if len(subLiteral) > len(literal) {
+				literal = subLiteral
+			}
+		}
+		return literal
+	}
+	return ""
+}
+
+// SplitTarget splits a route target into its service and instance, e.g. telnet:live is telnet and live.
+// instance is empty if the target has none
+func SplitTarget(target string) (service string, instance string) {
+	service, instance, _ = strings.Cut(target, ":")
+	return service, instance
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"text/template"
 )
@@ -75,3 +76,49 @@ func TestRoute_LoadMessagePattern(t *testing.T) {
 		})
 	}
 }
+
+func TestRoute_TriggerLiteral(t *testing.T) {
+	tests := []struct {
+		regex string
+		line  string
+		want  string
+	}{
+		{`(\w+) says ooc, '(.*)'`, "Xackery says ooc, 'hi'", " says ooc, '"},
+		{`(\w+) tells the guild \[([0-9]+)\], '(.*)'`, "Xackery tells the guild [12], 'hi'", " tells the guild ["},
+		{`^Zone: (.*)`, "Zone: soldungb", "Zone: "},
+		{`(?i)(\w+) shouts, '(.*)'`, "Xackery SHOUTS, 'hi'", ""},
+		{`(\w+) (?:says|shouts), '(.*)'`, "Xackery shouts, 'hi'", ", '"},
+		{`(.*)`, "anything", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.regex, func(t *testing.T) {
+			r := &Route{IsEnabled: true, Trigger: Trigger{Regex: tt.regex}}
+			err := r.LoadTrigger()
+			if err != nil {
+				t.Fatalf("LoadTrigger: %s", err)
+			}
+			got := r.TriggerLiteral()
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			if !r.TriggerRegex().MatchString(tt.line) || !strings.Contains(tt.line, got) {
+				t.Fatalf("line %q should match and contain %q", tt.line, got)
+			}
+		})
+	}
+}
+
+func TestRoute_RateLimitKey(t *testing.T) {
+	ooc := Route{Trigger: Trigger{Regex: `(\w+) says ooc, '(.*)'`}, Target: "discord", ChannelID: "1"}
+	auction := Route{Trigger: Trigger{Regex: `(\w+) auctions, '(.*)'`}, Target: "discord", ChannelID: "2"}
+	if got := ooc.RateLimitKey("telnet"); got != "telnet.routes[bcf1473c]" {
+		t.Fatalf("key got %s, it should only depend on the route, not its position", got)
+	}
+	if ooc.RateLimitKey("telnet") == auction.RateLimitKey("telnet") {
+		t.Fatalf("different routes should have different keys")
+	}
+	ooc.RateLimit.Name = "ooc"
+	if got := ooc.RateLimitKey("telnet:live"); got != "telnet:live.routes[ooc]" {
+		t.Fatalf("named key got %s", got)
+	}
+}
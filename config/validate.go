@@ -0,0 +1,311 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xackery/talkeq/characterdb"
+	"github.com/xackery/talkeq/tmplfunc"
+)
+
+// placeholderRegex matches values left over from the default configuration, e.g. INSERTOOCCHANNELHERE
+var placeholderRegex = regexp.MustCompile(`INSERT[A-Z0-9]*HERE`)
+
+// sample data patterns are rendered with
+const (
+	sampleName    = "Xackery"
+	sampleMessage = "Hello, Norrath"
+)
+
+// Problem is an issue found while validating a configuration
+type Problem struct {
+	// Section is where the problem was found, e.g. telnet.routes[0]
+	Section string
+	Message string
+}
+
+// String returns a readable problem
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Section, p.Message)
+}
+
+// Validate checks a configuration more thoroughly than Verify, without connecting anywhere.
+// Every regex is compiled, indexes are checked against regex groups, and every pattern is rendered with sample data.
+// Only enabled services and routes are checked. Unlike Verify it doesn't stop at the first problem, so c
+// should come from Decode, Load would have already failed on one. Returns every problem found
+func Validate(c *Config) []Problem {
+	v := &validator{
+		config:   c,
+		problems: []Problem{},
+	}
+
+	if c.API.IsEnabled {
+		api := c.API
+		if err := api.Verify(); err != nil {
+			v.add("api", "%s", err)
+		}
+	}
+	names := map[string]bool{}
+	for i, instance := range c.TelnetInstances {
+		section := fmt.Sprintf("telnet_instances[%d]", i)
+		switch {
+		case instance.Name == "":
+			v.add(section, "name must be set")
+		case strings.Contains(instance.Name, ":"):
+			v.add(section, "name %s can't contain ':'", instance.Name)
+		case names[instance.Name]:
+			v.add(section, "name %s is used more than once", instance.Name)
+		}
+		names[instance.Name] = true
+	}
+	if c.Outbox.IsEnabled {
+		outbox := c.Outbox
+		if err := outbox.Verify(); err != nil {
+			v.add("outbox", "%s", err)
+		}
+	}
+
+	if c.Discord.IsEnabled {
+		if c.Discord.Token == "" {
+			v.add("discord", "bot_token is empty")
+		}
+		if c.Discord.ServerID == "" {
+			v.add("discord", "server_id is empty")
+		}
+		if c.Discord.ClientID == "" {
+			v.add("discord", "client_id is empty")
+		}
+		// the same shape as discord's WorldStatus, which bot_status renders with
+		v.pattern("discord", "bot_status", c.Discord.BotStatus, struct {
+			World       string
+			PlayerCount int
+		}{"live", 42})
+		v.pattern("discord", "webhook_avatar_url", c.Discord.WebhookAvatarURL, characterdb.Character{
+			Name: sampleName, Level: 60, Class: "Shadow Knight", Race: "Dark Elf", Zone: "soldungb",
+		})
+		if err := c.Discord.RoleSync.Verify(); err != nil {
+			v.add("discord.role_sync", "%s", err)
+		}
+		if c.Discord.RoleSync.IsEnabled {
+			for i, role := range c.Discord.RoleSync.Roles {
+				v.placeholder(fmt.Sprintf("discord.role_sync.roles[%d]", i), "role_id", role.RoleID)
+			}
+		}
+		if c.Discord.Tell.IsEnabled {
+			target := c.Discord.Tell.Target
+			if target == "" {
+				target = "telnet"
+			}
+			if service, _ := SplitTarget(target); service != "telnet" {
+				v.add("discord.tell", "target %s is not telnet or telnet:<name>", target)
+			} else {
+				v.target("discord.tell", target)
+			}
+			v.pattern("discord.tell", "message_pattern", c.Discord.Tell.MessagePattern, struct {
+				From    string
+				To      string
+				Message string
+			}{sampleName, "Shin", sampleMessage})
+		}
+		for i, route := range c.Discord.Routes {
+			if !route.IsEnabled {
+				continue
+			}
+			section := fmt.Sprintf("discord.routes[%d]", i)
+			if route.ChannelID == "" {
+				v.add(section, "channel_id is empty")
+			}
+			v.placeholder(section, "discord_trigger.channel_id", route.Trigger.ChannelID)
+			v.placeholder(section, "channel_id", route.ChannelID)
+			v.target(section, route.Target)
+			if err := route.Filter.Load(); err != nil {
+				v.add(section, "filter: %s", err)
+			}
+			if err := route.RateLimit.Load(); err != nil {
+				v.add(section, "rate_limit: %s", err)
+			}
+			v.placeholder(section, "guild_id", route.GuildID)
+			v.pattern(section, "message_pattern", route.MessagePattern, struct {
+				Name      string
+				Message   string
+				ChannelID string
+			}{sampleName, sampleMessage, route.ChannelID})
+		}
+	}
+
+	if c.Telnet.IsEnabled {
+		v.routes("telnet", c.Telnet.Routes)
+	}
+	for i, instance := range c.TelnetInstances {
+		if instance.IsEnabled {
+			v.routes(fmt.Sprintf("telnet_instances[%d]", i), instance.Routes)
+		}
+	}
+	if c.EQLog.IsEnabled {
+		v.routes("eqlog", c.EQLog.Routes)
+	}
+	if c.PEQEditor.IsEnabled && c.PEQEditor.SQL.IsEnabled {
+		if c.PEQEditor.SQL.Path == "" {
+			v.add("peq_editor.sql", "path is empty")
+		}
+		if c.PEQEditor.SQL.FilePattern == "" {
+			v.add("peq_editor.sql", "file_pattern is empty")
+		}
+		v.pattern("peq_editor.sql", "file_pattern", c.PEQEditor.SQL.FilePattern, struct {
+			Year  int
+			Month string
+		}{2006, "01"})
+		v.routes("peq_editor.sql", c.PEQEditor.SQL.Routes)
+	}
+
+	if c.SQLReport.IsEnabled {
+		for i, e := range c.SQLReport.Entries {
+			section := fmt.Sprintf("sql_report.entries[%d]", i)
+			v.placeholder(section, "channel_id", e.ChannelID)
+			refresh, err := time.ParseDuration(e.Refresh)
+			if err != nil {
+				v.add(section, "refresh %s is invalid: %s", e.Refresh, err)
+			} else if refresh < 30*time.Second {
+				v.add(section, "refresh %s is lower than 30s", e.Refresh)
+			}
+			v.pattern(section, "pattern", e.Pattern, struct {
+				Data string
+			}{"42"})
+		}
+	}
+	return v.problems
+}
+
+type validator struct {
+	config   *Config
+	problems []Problem
+}
+
+func (v *validator) add(section string, format string, a ...interface{}) {
+	v.problems = append(v.problems, Problem{Section: section, Message: fmt.Sprintf(format, a...)})
+}
+
+// routes checks routes that are triggered by a regex
+func (v *validator) routes(name string, routes []Route) {
+	for i, route := range routes {
+		if !route.IsEnabled {
+			continue
+		}
+		section := fmt.Sprintf("%s.routes[%d]", name, i)
+		if route.ChannelID == "" && route.Target != "dm" {
+			v.add(section, "channel_id is empty")
+		}
+		v.placeholder(section, "channel_id", route.ChannelID)
+		v.placeholder(section, "guild_id", route.GuildID)
+		v.target(section, route.Target)
+		if err := route.Filter.Load(); err != nil {
+			v.add(section, "filter: %s", err)
+		}
+		if err := route.RateLimit.Load(); err != nil {
+			v.add(section, "rate_limit: %s", err)
+		}
+		if route.RateLimit.Action == RateLimitNotify {
+			v.add(section, "rate_limit action notify can only tell discord senders, limited messages are dropped")
+		}
+		service, _ := SplitTarget(route.Target)
+		if route.IsWebhook && service != "discord" {
+			v.add(section, "webhook only applies to discord targets, target is %s", route.Target)
+		}
+		if service == "dm" && route.Trigger.RecipientIndex == 0 {
+			v.add(section, "dm target needs recipient_index, the regex group of the character the message is to")
+		}
+		data := RouteMessage{
+			Name:    sampleName,
+			Message: sampleMessage,
+			Raw:     sampleName + " says, '" + sampleMessage + "'",
+			Groups:  map[string]string{},
+		}
+		if route.Trigger.Custom != "" {
+			v.routePatterns(section, route, data)
+			continue
+		}
+
+		pattern, err := regexp.Compile(route.Trigger.Regex)
+		if err != nil {
+			v.add(section, "trigger regex %q does not compile: %s", route.Trigger.Regex, err)
+			v.routePatterns(section, route, data)
+			continue
+		}
+		for _, groupName := range pattern.SubexpNames() {
+			if groupName != "" {
+				data.Groups[groupName] = groupName
+			}
+		}
+		v.routePatterns(section, route, data)
+		groups := pattern.NumSubexp()
+		indexes := []struct {
+			key   string
+			value int
+		}{
+			{"name_index", route.Trigger.NameIndex},
+			{"message_index", route.Trigger.MessageIndex},
+			{"guild_index", route.Trigger.GuildIndex},
+			{"recipient_index", route.Trigger.RecipientIndex},
+		}
+		for _, index := range indexes {
+			if index.value < 0 || index.value > groups {
+				v.add(section, "trigger %s %d is out of range, regex %q has %d groups", index.key, index.value, route.Trigger.Regex, groups)
+			}
+		}
+	}
+}
+
+// routePatterns renders a route's message pattern, and its embed's patterns, with sample data
+func (v *validator) routePatterns(section string, route Route, data RouteMessage) {
+	v.pattern(section, "message_pattern", route.MessagePattern, data)
+	if !route.Embed.IsEnabled {
+		return
+	}
+	service, _ := SplitTarget(route.Target)
+	if service != "discord" {
+		v.add(section, "embed only applies to discord targets, target is %s", route.Target)
+	}
+	_, err := parseColor(route.Embed.Color)
+	if err != nil {
+		v.add(section, "embed color: %s", err)
+	}
+	v.pattern(section, "embed.title", route.Embed.Title, data)
+	v.pattern(section, "embed.description", route.Embed.Description, data)
+	v.pattern(section, "embed.author", route.Embed.Author, data)
+	v.pattern(section, "embed.footer", route.Embed.Footer, data)
+}
+
+// pattern renders a template pattern with sample data.
+// Missing map keys are errors, so a typo in a regex group name such as {{.Groups.zone}} is caught
+func (v *validator) pattern(section string, key string, pattern string, data interface{}) {
+	v.placeholder(section, key, pattern)
+	tmpl, err := tmplfunc.New("root").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		v.add(section, "%s does not parse: %s", key, err)
+		return
+	}
+	buf := new(bytes.Buffer)
+	err = tmpl.Execute(buf, data)
+	if err != nil {
+		v.add(section, "%s does not render: %s", key, err)
+	}
+}
+
+// target flags a route target talkeq can't relay to
+func (v *validator) target(section string, target string) {
+	if err := v.config.verifyTarget(target); err != nil {
+		v.add(section, "%s", err)
+	}
+}
+
+// placeholder flags values left over from the default configuration
+func (v *validator) placeholder(section string, key string, value string) {
+	placeholder := placeholderRegex.FindString(value)
+	if placeholder == "" {
+		return
+	}
+	v.add(section, "%s still has placeholder %s", key, placeholder)
+}
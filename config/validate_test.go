@@ -0,0 +1,175 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := getDefaultConfig()
+	cfg.Discord.Token = "token"
+	cfg.Discord.ServerID = "1"
+	cfg.Discord.ClientID = "2"
+	cfg.Discord.Routes[0].Trigger.ChannelID = "3"
+	cfg.Discord.BotStatus = "{{.World}}: {{.PlayerCount}} Online"
+	cfg.EQLog.IsEnabled = false
+	cfg.Telnet.Routes = []Route{
+		{
+			IsEnabled: true,
+			Trigger:   Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:    "discord", ChannelID: "4", MessagePattern: "{{.Name}} **OOC**: {{.Message}}",
+		},
+		{
+			IsEnabled: true,
+			Trigger:   Trigger{Regex: `(\w+) auctions, '(.*)'`, NameIndex: 1, MessageIndex: 3},
+			Target:    "discord", ChannelID: "INSERTAUCTIONCHANNELHERE", MessagePattern: "{{.Name}}: {{.Message}}",
+			RateLimit: RateLimit{SenderPerMinute: 6, Action: RateLimitNotify},
+		},
+		{
+			IsEnabled: true,
+			Trigger:   Trigger{Regex: `(\w+) says, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:    "telnet", ChannelID: "8", MessagePattern: "{{.Message}}",
+			IsWebhook: true,
+		},
+		{
+			IsEnabled: true,
+			Trigger:   Trigger{Regex: `(\w+ says`, NameIndex: 1},
+			Target:    "discord", ChannelID: "5", MessagePattern: "{{.Name}}",
+		},
+		{
+			IsEnabled: true,
+			Trigger:   Trigger{Regex: `(\w+) shouts, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:    "discord", ChannelID: "6", MessagePattern: "{{.Shout}}",
+		},
+		{
+			IsEnabled: true,
+			Trigger:   Trigger{Regex: `(?P<killer>\w+) has killed (?P<boss>[\w ]+) in (?P<zone>\w+)`},
+			Target:    "discord", ChannelID: "7", MessagePattern: "{{.Groups.killer}} killed {{.Groups.boss}} in {{.Groups.zon}}",
+			Embed: Embed{IsEnabled: true, Color: "orange", Footer: "{{.Groups.channel}}"},
+		},
+		{
+			IsEnabled: true,
+			Trigger:   Trigger{Regex: `(\w+) tells (\w+), '(.*)'`, NameIndex: 1, MessageIndex: 3},
+			Target:    "dm", MessagePattern: "{{.Name}} tells you, '{{.Message}}'",
+		},
+		{
+			Trigger: Trigger{Regex: `(`},
+			Target:  "discord", ChannelID: "INSERTDISABLEDHERE",
+		},
+	}
+
+	problems := Validate(&cfg)
+	want := []string{
+		"telnet.routes[1]: rate_limit action notify",
+		"telnet.routes[1]: channel_id still has placeholder INSERTAUCTIONCHANNELHERE",
+		"telnet.routes[1]: trigger message_index 3 is out of range",
+		"telnet.routes[2]: webhook only applies to discord targets",
+		"telnet.routes[3]: trigger regex",
+		"telnet.routes[4]: message_pattern does not render",
+		"telnet.routes[5]: message_pattern does not render",
+		"telnet.routes[5]: embed color: orange is not a hex color",
+		"telnet.routes[5]: embed.footer does not render",
+		"telnet.routes[6]: dm target needs recipient_index",
+	}
+	for _, w := range want {
+		isFound := false
+		for _, p := range problems {
+			if strings.HasPrefix(p.String(), w) {
+				isFound = true
+				break
+			}
+		}
+		if !isFound {
+			t.Errorf("missing problem %q in %v", w, problems)
+		}
+	}
+	for _, p := range problems {
+		if strings.HasPrefix(p.Section, "telnet.routes[0]") || strings.HasPrefix(p.Section, "telnet.routes[7]") || strings.HasPrefix(p.Section, "discord") {
+			t.Errorf("unexpected problem %s", p)
+		}
+	}
+}
+
+func TestValidate_RoleSync(t *testing.T) {
+	cfg := getDefaultConfig()
+	cfg.Discord.Token = "token"
+	cfg.Discord.ServerID = "1"
+	cfg.Discord.ClientID = "2"
+	cfg.Discord.RoleSync.IsEnabled = true
+
+	problems := Validate(&cfg)
+	want := "discord.role_sync.roles[0]: role_id still has placeholder INSERTLEVEL60ROLEHERE"
+	isFound := false
+	for _, p := range problems {
+		if p.String() == want {
+			isFound = true
+		}
+	}
+	if !isFound {
+		t.Fatalf("missing problem %q in %v", want, problems)
+	}
+}
+
+func TestValidate_Decode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "talkeq.conf")
+	data := `
+[telnet]
+enabled = true
+
+[[telnet.routes]]
+enabled = true
+target = "discord"
+channel_id = "1"
+message_pattern = "{{.Name}"
+[telnet.routes.trigger]
+telnet_pattern = "(\\w+) says ooc, '(.*)'"
+name_index = 1
+message_index = 2
+
+[[telnet.routes]]
+enabled = true
+target = "irc"
+channel_id = "2"
+message_pattern = "{{.Name}}: {{.Message}}"
+[telnet.routes.trigger]
+telnet_pattern = "(\\w+ auctions"
+name_index = 1
+[telnet.routes.filter]
+exclude = ["("]
+`
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	_, err = Load(path)
+	if err == nil {
+		t.Fatalf("load: expected a verify error")
+	}
+
+	cfg, err := Decode(path)
+	if err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	problems := Validate(cfg)
+	want := []string{
+		"telnet.routes[0]: message_pattern does not parse",
+		"telnet.routes[1]: unknown target irc",
+		"telnet.routes[1]: filter: exclude",
+		"telnet.routes[1]: trigger regex",
+	}
+	for _, w := range want {
+		isFound := false
+		for _, p := range problems {
+			if strings.HasPrefix(p.String(), w) {
+				isFound = true
+				break
+			}
+		}
+		if !isFound {
+			t.Errorf("missing problem %q in %v", w, problems)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/xackery/talkeq/tlog"
+)
+
+// Watch reloads the configuration file at path each time it changes, calling onChange with the new configuration.
+// If the new configuration fails to load or verify, it is rejected and onChange is not called
+func Watch(ctx context.Context, path string, onChange func(cfg *Config)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("newWatcher: %w", err)
+	}
+
+	// the directory is watched instead of the file, since many editors save by replacing the file
+	dir := filepath.Dir(path)
+	err = watcher.Add(dir)
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("watcherAdd: %w", err)
+	}
+
+	go watchLoop(ctx, watcher, path, onChange)
+	return nil
+}
+
+func watchLoop(ctx context.Context, watcher *fsnotify.Watcher, path string, onChange func(cfg *Config)) {
+	defer watcher.Close()
+	name := filepath.Clean(path)
+
+	// editors often write a file more than once when saving, so reloads wait for changes to settle
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			tlog.Debugf("[config] watch exiting, context done")
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				tlog.Warn("[config] watch failed to read events")
+				return
+			}
+			if filepath.Clean(event.Name) != name {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			reload = time.After(500 * time.Millisecond)
+		case <-reload:
+			reload = nil
+			tlog.Infof("[config] %s modified, reloading", path)
+			cfg, err := Load(path)
+			if err != nil {
+				tlog.Errorf("[config] reload rejected, keeping previous config: %s", err)
+				continue
+			}
+			onChange(cfg)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			tlog.Warnf("[config] watch failed, ignoring: %s", err)
+		}
+	}
+}
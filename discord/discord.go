@@ -9,13 +9,14 @@ import (
 	"runtime"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/xackery/talkeq/config"
 	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/split"
 	"github.com/xackery/talkeq/tlog"
+	"github.com/xackery/talkeq/tmplfunc"
 )
 
 const (
@@ -35,7 +36,21 @@ type Discord struct {
 	id            string
 	lastMessageID string
 	lastChannelID string
-	commands      map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) (string, error)
+	commands      map[string]command
+	worldsMu      sync.RWMutex
+	worlds        []world
+	webhooksMu    sync.Mutex
+	webhooks      map[string]*discordgo.Webhook
+	rolesMu       sync.Mutex
+	// syncedRoles is which role_sync roles each user was last synced to have
+	syncedRoles map[string]map[string]bool
+}
+
+// WorldStatus is how many players are online in a world, shown in the bot status
+type WorldStatus struct {
+	// World is the name of the world, and can be empty if there is only one world
+	World       string
+	PlayerCount int
 }
 
 // New creates a new discord connect
@@ -47,9 +62,7 @@ func New(ctx context.Context, config config.Discord) (*Discord, error) {
 		cancel: cancel,
 		config: config,
 	}
-	t.commands = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) (string, error){
-		"who": t.who,
-	}
+	t.commands = t.newCommands(config)
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -139,17 +152,14 @@ func (t *Discord) Connect(ctx context.Context) error {
 	t.id = myUser.ID
 	tlog.Debugf("[discord] @me id: %s", t.id)
 
-	err = t.StatusUpdate(ctx, 0, "Status: Online")
+	err = t.conn.UpdateGameStatus(0, "Status: Online")
 	if err != nil {
-		return err
+		return fmt.Errorf("update status: %w", err)
 	}
 
-	// TODO: Get this working
-	if 1 == 0 {
-		err = t.whoRegister()
-		if err != nil {
-			return fmt.Errorf("whoRegister: %w", err)
-		}
+	err = t.syncCommands()
+	if err != nil {
+		tlog.Warnf("[discord] slash commands like /who are unavailable, the bot may need the applications.commands scope. visit https://discordapp.com/oauth2/authorize?&client_id=%s&scope=bot%%20applications.commands&permissions=268504080 to authorize: %s", t.config.ClientID, err)
 	}
 
 	return nil
@@ -168,33 +178,95 @@ func (t *Discord) loop(ctx context.Context) {
 	}
 }
 
-// StatusUpdate updates the status text on discord
-func (t *Discord) StatusUpdate(ctx context.Context, online int, customText string) error {
+// StatusUpdate updates the status text on discord.
+// bot_status is rendered for each world, and worlds are joined with a separator.
+// Named worlds are prefixed with their name unless bot_status already includes {{.World}}
+func (t *Discord) StatusUpdate(ctx context.Context, worlds []WorldStatus, customText string) error {
 	var err error
+	cfg, conn, isConnected := t.snapshot()
+	if !isConnected {
+		return fmt.Errorf("not connected")
+	}
 	if customText != "" {
-		err = t.conn.UpdateGameStatus(0, customText)
+		err = conn.UpdateGameStatus(0, customText)
 		if err != nil {
 			return err
 		}
 		return nil
 	}
-	tmpl := template.New("online")
-	tmpl.Parse(t.config.BotStatus)
+	botStatus := cfg.BotStatus
+	tmpl, err := tmplfunc.New("online").Parse(botStatus)
+	if err != nil {
+		return fmt.Errorf("parse bot_status: %w", err)
+	}
 
-	buf := new(bytes.Buffer)
-	tmpl.Execute(buf, struct {
-		PlayerCount int
-	}{
-		online,
-	})
+	statuses := []string{}
+	for _, w := range worlds {
+		buf := new(bytes.Buffer)
+		err = tmpl.Execute(buf, w)
+		if err != nil {
+			return fmt.Errorf("execute bot_status: %w", err)
+		}
+		status := buf.String()
+		if w.World != "" && !strings.Contains(botStatus, ".World") {
+			status = fmt.Sprintf("%s %s", w.World, status)
+		}
+		statuses = append(statuses, status)
+	}
 
-	err = t.conn.UpdateGameStatus(0, buf.String())
+	err = conn.UpdateGameStatus(0, strings.Join(statuses, " | "))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// SetConfig swaps in a new configuration, such as routes, without dropping the connection.
+// Returns true if connection settings changed and discord needs to reconnect for them to apply
+func (t *Discord) SetConfig(cfg config.Discord) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	isReconnect := t.config.IsEnabled != cfg.IsEnabled ||
+		t.config.Token != cfg.Token ||
+		t.config.ServerID != cfg.ServerID ||
+		t.config.ClientID != cfg.ClientID
+	isTellChanged := t.config.Tell.IsEnabled != cfg.Tell.IsEnabled
+	t.config = cfg
+	if !isTellChanged {
+		return isReconnect
+	}
+	t.commands = t.newCommands(cfg)
+	// a reconnect syncs commands on its own
+	if isReconnect || !t.isConnected || t.conn == nil {
+		return isReconnect
+	}
+	err := t.syncCommands()
+	if err != nil {
+		tlog.Warnf("[discord] tell.enabled changed, but slash commands failed to update, restart talkeq to apply: %s", err)
+	}
+	return isReconnect
+}
+
+// newCommands returns the slash commands cfg enables
+func (t *Discord) newCommands(cfg config.Discord) map[string]command {
+	commands := map[string]command{
+		"who": {definition: whoCommand, run: t.who, update: t.whoUpdate},
+	}
+	if cfg.Tell.IsEnabled {
+		commands["tell"] = command{definition: tellCommand, run: t.tell}
+		commands["tells"] = command{definition: tellsCommand, run: t.tells}
+	}
+	return commands
+}
+
+// snapshot returns the config and connection in use. Anything not run while holding t.mu, such as Send,
+// should use it, since SetConfig can swap the config at any time
+func (t *Discord) snapshot() (config.Discord, *discordgo.Session, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.config, t.conn, t.isConnected
+}
+
 // IsConnected returns if a connection is established
 func (t *Discord) IsConnected() bool {
 	t.mu.RLock()
@@ -206,10 +278,8 @@ func (t *Discord) IsConnected() bool {
 // Disconnect stops a previously started connection with Discord.
 // If called while a connection is not active, returns nil
 func (t *Discord) Disconnect(ctx context.Context) error {
-	if !t.config.IsEnabled {
-		tlog.Debugf("[discord] is disabled, skipping disconnect")
-		return nil
-	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if !t.isConnected {
 		tlog.Debugf("[discord] already disconnected, skipping disconnect")
 		return nil
@@ -218,31 +288,113 @@ func (t *Discord) Disconnect(ctx context.Context) error {
 	if err != nil {
 		tlog.Warnf("[discord] disconnect failed: %s", err)
 	}
+	t.cancel()
 	t.conn = nil
 	t.isConnected = false
 	return nil
 }
 
-// Send sends a message to discord
+// Send sends a message to discord. A long message is sent as several parts, and stops at the first part that fails,
+// callers that retry should send each of Parts on its own instead
 func (t *Discord) Send(req request.DiscordSend) error {
-	if !t.config.IsEnabled {
+	cfg, conn, isConnected := t.snapshot()
+	if !cfg.IsEnabled {
 		return fmt.Errorf("not enabled")
 	}
 
-	if !t.isConnected {
+	if !isConnected {
 		return fmt.Errorf("not connected")
 	}
 
-	msg, err := t.conn.ChannelMessageSendComplex(req.ChannelID, &discordgo.MessageSend{
+	parts := Parts(req)
+	for i, part := range parts {
+		err := t.sendPart(cfg, conn, part)
+		if err != nil {
+			if len(parts) == 1 {
+				return err
+			}
+			return fmt.Errorf("part %d of %d: %w", i+1, len(parts), err)
+		}
+	}
+	return nil
+}
+
+// Parts splits a message too long for discord into several, in order, marked e.g. (1/3), and an embed goes with the last
+func Parts(req request.DiscordSend) []request.DiscordSend {
+	texts := split.Split(req.Message, split.DiscordMaxLength)
+	if len(texts) == 1 {
+		return []request.DiscordSend{req}
+	}
+	parts := []request.DiscordSend{}
+	for i, text := range texts {
+		part := req
+		part.Message = text
+		if i < len(texts)-1 {
+			part.Embed = nil
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// sendPart sends a message that fits in one discord message
+func (t *Discord) sendPart(cfg config.Discord, conn *discordgo.Session, req request.DiscordSend) error {
+	embeds := []*discordgo.MessageEmbed{}
+	if req.Embed != nil {
+		embeds = append(embeds, embed(req.Embed))
+	}
+	if req.Username != "" {
+		msg, err := t.sendWebhook(conn, cfg.WebhookAvatarURL, req.ChannelID, req.Username, &discordgo.WebhookParams{
+			Content:         req.Message,
+			Embeds:          embeds,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			return fmt.Errorf("sendWebhook: %w", err)
+		}
+		t.setLastSentMessage(msg)
+		return nil
+	}
+	msg, err := conn.ChannelMessageSendComplex(req.ChannelID, &discordgo.MessageSend{
 		Content:         req.Message,
+		Embeds:          embeds,
 		AllowedMentions: &discordgo.MessageAllowedMentions{},
 	})
 	if err != nil {
 		return fmt.Errorf("ChannelMessageSend: %w", err)
 	}
+	t.setLastSentMessage(msg)
+	return nil
+}
+
+// setLastSentMessage remembers msg for LastSentMessage
+func (t *Discord) setLastSentMessage(msg *discordgo.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.lastMessageID = msg.ID
 	t.lastChannelID = msg.ChannelID
-	return nil
+}
+
+// embed converts a relayed embed for discord
+func embed(e *request.Embed) *discordgo.MessageEmbed {
+	out := &discordgo.MessageEmbed{
+		Title:       e.Title,
+		Description: e.Description,
+		Color:       e.Color,
+	}
+	if e.Author != "" {
+		out.Author = &discordgo.MessageEmbedAuthor{Name: e.Author, URL: e.AuthorURL}
+	}
+	for _, field := range e.Fields {
+		out.Fields = append(out.Fields, &discordgo.MessageEmbedField{Name: field.Name, Value: field.Value, Inline: field.IsInline})
+	}
+	if e.Footer != "" {
+		out.Footer = &discordgo.MessageEmbedFooter{Text: e.Footer}
+	}
+	if !e.Timestamp.IsZero() {
+		out.Timestamp = e.Timestamp.Format(time.RFC3339)
+	}
+	return out
 }
 
 // Subscribe listens for new events on discord
@@ -263,11 +415,12 @@ func sanitize(data string) string {
 
 // SetChannelName is used for voice channel setting via SQLReport
 func (t *Discord) SetChannelName(channelID string, name string) error {
-	if !t.isConnected {
+	_, conn, isConnected := t.snapshot()
+	if !isConnected {
 		return fmt.Errorf("discord not connected")
 	}
 
-	if _, err := t.conn.ChannelEdit(channelID, &discordgo.ChannelEdit{Name: name}); err != nil {
+	if _, err := conn.ChannelEdit(channelID, &discordgo.ChannelEdit{Name: name}); err != nil {
 		return fmt.Errorf("edit channel failed: %w", err)
 	}
 	tlog.Debugf("[discord] setting channel to %s", name)
@@ -307,8 +460,35 @@ func (t *Discord) GetIGNName(s *discordgo.Session, serverID string, userid strin
 	return ""
 }
 
+// memberRoles returns the IDs and names of a user's roles
+func (t *Discord) memberRoles(s *discordgo.Session, serverID string, userID string) ([]string, error) {
+	if serverID == "" {
+		serverID = t.config.ServerID
+	}
+	member, err := s.GuildMember(serverID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("guildMember: %w", err)
+	}
+	guildRoles, err := s.GuildRoles(serverID)
+	if err != nil {
+		return nil, fmt.Errorf("guildRoles: %w", err)
+	}
+	roles := []string{}
+	for _, role := range member.Roles {
+		roles = append(roles, role)
+		for _, gRole := range guildRoles {
+			if gRole.ID == role {
+				roles = append(roles, gRole.Name)
+			}
+		}
+	}
+	return roles, nil
+}
+
 // LastSentMessage returns the channelID and message ID of last message sent
 func (t *Discord) LastSentMessage() (channelID string, messageID string, err error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if !t.config.IsEnabled {
 		return "", "", fmt.Errorf("not enabled")
 	}
@@ -320,13 +500,14 @@ func (t *Discord) LastSentMessage() (channelID string, messageID string, err err
 
 // EditMessage lets you edit a previously sent message
 func (t *Discord) EditMessage(channelID string, messageID string, message string) error {
-	if !t.config.IsEnabled {
+	cfg, conn, isConnected := t.snapshot()
+	if !cfg.IsEnabled {
 		return fmt.Errorf("not enabled")
 	}
-	if !t.isConnected {
+	if !isConnected {
 		return fmt.Errorf("not connected")
 	}
-	msg, err := t.conn.ChannelMessageEdit(channelID, messageID, message)
+	msg, err := conn.ChannelMessageEdit(channelID, messageID, message)
 	if err != nil {
 		return fmt.Errorf("edit: %w", err)
 	}
@@ -2,38 +2,85 @@ package discord
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/xackery/talkeq/tlog"
 )
 
+// command is a slash command, registered with discord at connect
+type command struct {
+	definition *discordgo.ApplicationCommand
+	// run answers the slash command
+	run func(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponseData, error)
+	// update answers a button on a previous answer, whose custom id is the command name, |, then args
+	update func(s *discordgo.Session, i *discordgo.InteractionCreate, args string) (*discordgo.InteractionResponseData, error)
+}
+
+// syncCommands registers every slash command with discord.
+// Commands registered before are replaced, so a command talkeq no longer has goes away
+func (t *Discord) syncCommands() error {
+	definitions := []*discordgo.ApplicationCommand{}
+	for _, cmd := range t.commands {
+		definitions = append(definitions, cmd.definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+	registered, err := t.conn.ApplicationCommandBulkOverwrite(t.conn.State.User.ID, t.config.ServerID, definitions)
+	if err != nil {
+		return fmt.Errorf("bulk overwrite: %w", err)
+	}
+	for _, cmd := range registered {
+		tlog.Debugf("[discord] registered /%s command", cmd.Name)
+	}
+	return nil
+}
+
 func (t *Discord) handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	cmd := i.ApplicationCommandData().Name
-	tlog.Debugf("[discord] command requested: %s", cmd)
-
-	var content string
+	var data *discordgo.InteractionResponseData
 	var err error
-	cmdFunc, ok := t.commands[strings.ToLower(cmd)]
-	if ok {
-		content, err = cmdFunc(s, i)
-	} else {
-		err = fmt.Errorf("unknown command")
+	responseType := discordgo.InteractionResponseChannelMessageWithSource
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		name := i.ApplicationCommandData().Name
+		tlog.Debugf("[discord] command requested: %s", name)
+		cmd, ok := t.commands[strings.ToLower(name)]
+		if !ok {
+			err = fmt.Errorf("unknown command %s", name)
+			break
+		}
+		data, err = cmd.run(s, i)
+	case discordgo.InteractionMessageComponent:
+		customID := i.MessageComponentData().CustomID
+		tlog.Debugf("[discord] component pressed: %s", customID)
+		responseType = discordgo.InteractionResponseUpdateMessage
+		name, args, _ := strings.Cut(customID, "|")
+		cmd, ok := t.commands[name]
+		if !ok || cmd.update == nil {
+			err = fmt.Errorf("unknown component %s", customID)
+			break
+		}
+		data, err = cmd.update(s, i, args)
+	default:
+		return
 	}
 
 	if err != nil {
 		tlog.Errorf("[discord] run command failed: %s", err)
+		data = &discordgo.InteractionResponseData{
+			Content: "Sorry, that command failed.",
+		}
 	}
+	data.Flags = discordgo.MessageFlagsEphemeral
 
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: content,
-			Flags:   1 << 6,
-		},
+		Type: responseType,
+		Data: data,
 	})
 	if err != nil {
 		tlog.Errorf("[discord] interactionRespond failed: %s", err)
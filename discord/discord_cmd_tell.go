@@ -0,0 +1,180 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/split"
+	"github.com/xackery/talkeq/tlog"
+	"github.com/xackery/talkeq/userdb"
+)
+
+// characterNameRegex matches a valid EQ character name
+var characterNameRegex = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// tellCommand is the definition of /tell
+var tellCommand = &discordgo.ApplicationCommand{
+	Name:        "tell",
+	Description: "Send a tell to a character in game from your registered character",
+	Options: []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionString, Name: "character", Description: "Character to send the tell to", Required: true},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "message", Description: "What to tell them", Required: true},
+	},
+}
+
+// tellsCommand is the definition of /tells
+var tellsCommand = &discordgo.ApplicationCommand{
+	Name:        "tells",
+	Description: "Choose if tells to your registered character are sent to you as DMs",
+	Options: []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionBoolean, Name: "dm", Description: "Get tells as DMs", Required: true},
+	},
+}
+
+func (t *Discord) tell(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponseData, error) {
+	userID := interactionUserID(i)
+	from := userdb.Name(userID)
+	if from == "" {
+		return &discordgo.InteractionResponseData{Content: "You need to register a character before you can send tells."}, nil
+	}
+	to := ""
+	msg := ""
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "character":
+			to = strings.TrimSpace(option.StringValue())
+		case "message":
+			msg = oneLine(sanitize(option.StringValue()))
+		}
+	}
+	if to == "" || msg == "" {
+		return &discordgo.InteractionResponseData{Content: "usage: /tell <character> <message>"}, nil
+	}
+	// to is sent as part of a console command, so anything but a name could run another
+	if !characterNameRegex.MatchString(to) {
+		return &discordgo.InteractionResponseData{Content: fmt.Sprintf("%q is not a character name, names are only letters.", to)}, nil
+	}
+
+	tell := &t.config.Tell
+	pattern, err := renderTell(tell, from, to, "")
+	if err != nil {
+		return nil, fmt.Errorf("render tell: %w", err)
+	}
+	parts, err := t.splitTelnet(msg, len(pattern))
+	if err != nil {
+		return &discordgo.InteractionResponseData{Content: fmt.Sprintf("Your tell was not sent: %s", err)}, nil
+	}
+	_, instance := config.SplitTarget(tell.Target)
+	for _, part := range parts {
+		text, err := renderTell(tell, from, to, part)
+		if err != nil {
+			return nil, fmt.Errorf("render tell: %w", err)
+		}
+		req := request.TelnetSend{
+			Ctx:      context.Background(),
+			Instance: instance,
+			Message:  text,
+		}
+		for _, s := range t.subscribers {
+			err = s(req)
+			if err != nil {
+				return nil, fmt.Errorf("send tell: %w", err)
+			}
+		}
+		tlog.Infof("[discord->%s] tell from %s: %s", tell.Target, userID, text)
+	}
+	return &discordgo.InteractionResponseData{Content: fmt.Sprintf("You told %s, '%s'", to, msg)}, nil
+}
+
+// renderTell executes the tell's message pattern
+func renderTell(tell *config.DiscordTell, from string, to string, msg string) (string, error) {
+	buf := new(bytes.Buffer)
+	err := tell.MessagePatternTemplate().Execute(buf, struct {
+		From    string
+		To      string
+		Message string
+	}{from, to, msg})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (t *Discord) tells(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponseData, error) {
+	userID := interactionUserID(i)
+	name := userdb.Name(userID)
+	if name == "" {
+		return &discordgo.InteractionResponseData{Content: "You need to register a character before you can get its tells."}, nil
+	}
+	isEnabled := false
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "dm" {
+			isEnabled = option.BoolValue()
+		}
+	}
+	err := userdb.SetDMEnabled(userID, isEnabled)
+	if err != nil {
+		return nil, fmt.Errorf("setDMEnabled: %w", err)
+	}
+	if !isEnabled {
+		return &discordgo.InteractionResponseData{Content: fmt.Sprintf("Tells to %s are no longer sent to you.", name)}, nil
+	}
+	return &discordgo.InteractionResponseData{Content: fmt.Sprintf("Tells to %s will be sent to you as DMs.", name)}, nil
+}
+
+// SendDM sends a message to the discord user registered to a character, if they opted in to DMs with /tells
+func (t *Discord) SendDM(req request.DiscordDM) error {
+	cfg, conn, isConnected := t.snapshot()
+	if !cfg.IsEnabled {
+		return fmt.Errorf("not enabled")
+	}
+	if !isConnected {
+		return fmt.Errorf("not connected")
+	}
+
+	userID := userdb.DiscordID(req.Character)
+	if userID == "" {
+		tlog.Debugf("[discord] dm to %s discarded, no user is registered to them", req.Character)
+		return nil
+	}
+	if !userdb.IsDMEnabled(userID) {
+		tlog.Debugf("[discord] dm to %s discarded, user %s has not opted in with /tells", req.Character, userID)
+		return nil
+	}
+	channel, err := conn.UserChannelCreate(userID)
+	if err != nil {
+		return fmt.Errorf("userChannelCreate: %w", err)
+	}
+	for _, part := range split.Split(req.Message, split.DiscordMaxLength) {
+		_, err = conn.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+			Content:         part,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			return fmt.Errorf("channelMessageSend: %w", err)
+		}
+	}
+	return nil
+}
+
+// interactionUserID returns who used a command, in a server or a DM
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// oneLine joins the lines of text with spaces, since a line break sent to telnet ends the command and starts another
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
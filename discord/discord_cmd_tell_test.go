@@ -0,0 +1,20 @@
+package discord
+
+import "testing"
+
+func TestTellInput(t *testing.T) {
+	msg := oneLine("hi\r\n#kill Xackery\nbye")
+	if msg != "hi #kill Xackery bye" {
+		t.Fatalf("got %q, wanted line breaks replaced", msg)
+	}
+	for _, to := range []string{"Xackery", "shin"} {
+		if !characterNameRegex.MatchString(to) {
+			t.Fatalf("expected %q to be a character name", to)
+		}
+	}
+	for _, to := range []string{"Xackery\n#shutdown", "Xackery Shin", "Xackery;", ""} {
+		if characterNameRegex.MatchString(to) {
+			t.Fatalf("expected %q to be rejected", to)
+		}
+	}
+}
@@ -2,38 +2,221 @@ package discord
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/xackery/talkeq/characterdb"
-	"github.com/xackery/talkeq/tlog"
+	"github.com/xackery/talkeq/split"
+	"github.com/xackery/talkeq/tmplfunc"
 )
 
-func (t *Discord) whoRegister() error {
-	tlog.Debugf("[discord] registering who command")
-	_, err := t.conn.ApplicationCommandCreate(t.conn.State.User.ID, t.config.ServerID, &discordgo.ApplicationCommand{
-		Name:        "who",
-		Description: "get a list of players on server, can filter by zone or name with /who <filter>",
-	})
+const (
+	// whoPageSize is the most players a page of /who lists, pages hold less if they would be too long for discord
+	whoPageSize = 20
+	// whoDescriptionLength is how much of the filter description a page of /who shows
+	whoDescriptionLength = 200
+)
+
+// minLevel is the lowest level the /who level options accept
+var minLevel = 1.0
+
+// whoCommand is the definition of /who
+var whoCommand = &discordgo.ApplicationCommand{
+	Name:        "who",
+	Description: "List players online",
+	Options: []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Only players whose name contains this"},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "zone", Description: "Only players in a zone, e.g. soldungb"},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "class", Description: "Only players of a class, e.g. Shadow Knight"},
+		{Type: discordgo.ApplicationCommandOptionInteger, Name: "min_level", Description: "Only players of at least this level", MinValue: &minLevel},
+		{Type: discordgo.ApplicationCommandOptionInteger, Name: "max_level", Description: "Only players of at most this level", MinValue: &minLevel},
+	},
+}
+
+// whoQuery is what a page of /who lists. It is kept in the custom id of the page buttons
+type whoQuery struct {
+	filter characterdb.Filter
+	page   int
+}
+
+func (t *Discord) who(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponseData, error) {
+	query := whoQuery{}
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "name":
+			query.filter.Name = option.StringValue()
+		case "zone":
+			query.filter.Zone = option.StringValue()
+		case "class":
+			query.filter.Class = option.StringValue()
+		case "min_level":
+			query.filter.MinLevel = int(option.IntValue())
+		case "max_level":
+			query.filter.MaxLevel = int(option.IntValue())
+		}
+	}
+	return t.whoPage(query), nil
+}
+
+// whoUpdate answers the previous and next buttons of /who
+func (t *Discord) whoUpdate(s *discordgo.Session, i *discordgo.InteractionCreate, args string) (*discordgo.InteractionResponseData, error) {
+	query, err := parseWhoQuery(args)
 	if err != nil {
-		return fmt.Errorf("whoRegister commandCreate: %w", err)
-	}
-	return nil
-}
-
-func (t *Discord) who(s *discordgo.Session, i *discordgo.InteractionCreate) (content string, err error) {
-	appCmdData := i.ApplicationCommandData()
-	/*	if len(appCmdData.Options) == 0 {
-		content = "usage: /who all, /who <name>"
-		return
-	}*/
-	arg := ""
-	if len(appCmdData.Options) > 0 {
-		arg = fmt.Sprintf("%s", i.ApplicationCommandData().Options[0].Value)
-		if arg == "all" {
-			arg = ""
+		return nil, fmt.Errorf("parse who query: %w", err)
+	}
+	return t.whoPage(query), nil
+}
+
+// whoPage lists a page of players in every world that match query, with buttons to the pages around it
+func (t *Discord) whoPage(query whoQuery) *discordgo.InteractionResponseData {
+	t.worldsMu.RLock()
+	defer t.worldsMu.RUnlock()
+	if len(t.worlds) == 0 {
+		return &discordgo.InteractionResponseData{Content: "No worlds are connected."}
+	}
+
+	lines := []string{}
+	hiddenCount := 0
+	for _, w := range t.worlds {
+		characters, hidden := w.db.Online(query.filter)
+		hiddenCount += hidden
+		for _, c := range characters {
+			line := fmt.Sprintf("%s (%d %s) in %s", c.Name, c.Level, c.Class, c.Zone)
+			if w.name != "" {
+				line = fmt.Sprintf("**%s**: %s", w.name, line)
+			}
+			lines = append(lines, line)
 		}
 	}
 
-	content = characterdb.CharactersOnline(arg)
-	return
+	content := fmt.Sprintf("There %s %d %s online", tmplfunc.Pluralize(len(lines), "is", "are"), len(lines), tmplfunc.Pluralize(len(lines), "player", "players"))
+	description := query.filter.String()
+	if description != "" {
+		// options are typed by the user, so keep them from crowding out the players
+		content += " who match " + tmplfunc.Truncate(whoDescriptionLength, description)
+	}
+	if hiddenCount > 0 {
+		content += fmt.Sprintf(" (%d hidden)", hiddenCount)
+	}
+
+	// leave room for the page count after content
+	pages := whoPages(lines, split.DiscordMaxLength-utf8.RuneCountInString(content+", page 9999 of 9999:\n"))
+	pageCount := len(pages)
+	if pageCount < 1 {
+		pageCount = 1
+	}
+	if query.page >= pageCount {
+		query.page = pageCount - 1
+	}
+	if query.page < 0 {
+		query.page = 0
+	}
+
+	if pageCount > 1 {
+		content += fmt.Sprintf(", page %d of %d", query.page+1, pageCount)
+	}
+	if len(lines) > 0 {
+		content += ":\n" + strings.Join(pages[query.page], "\n")
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Content:    content,
+		Components: []discordgo.MessageComponent{},
+	}
+	if pageCount > 1 {
+		previous, next := query, query
+		previous.page--
+		next.page++
+		data.Components = append(data.Components, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Previous", Style: discordgo.SecondaryButton, CustomID: previous.customID(), Disabled: query.page == 0},
+				discordgo.Button{Label: "Next", Style: discordgo.SecondaryButton, CustomID: next.customID(), Disabled: query.page == pageCount-1},
+			},
+		})
+	}
+	return data
+}
+
+// whoPages splits lines into pages of up to whoPageSize lines, each at most maxLength characters once joined by new lines.
+// A line longer than maxLength is cut to fit a page of its own
+func whoPages(lines []string, maxLength int) [][]string {
+	pages := [][]string{}
+	page := []string{}
+	length := 0
+	for _, line := range lines {
+		line = tmplfunc.Truncate(maxLength, line)
+		lineLength := utf8.RuneCountInString(line)
+		if len(page) > 0 && (len(page) == whoPageSize || length+1+lineLength > maxLength) {
+			pages = append(pages, page)
+			page = []string{}
+			length = 0
+		}
+		if len(page) > 0 {
+			length++
+		}
+		page = append(page, line)
+		length += lineLength
+	}
+	if len(page) > 0 {
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// customID encodes q for a button, e.g. who|1|xack|||50|60. Text is cut to fit discord's 100 character limit
+func (q whoQuery) customID() string {
+	clean := func(s string) string {
+		runes := []rune(strings.ReplaceAll(s, "|", ""))
+		if len(runes) > 20 {
+			runes = runes[:20]
+		}
+		return string(runes)
+	}
+	return fmt.Sprintf("who|%d|%s|%s|%s|%d|%d", q.page, clean(q.filter.Name), clean(q.filter.Zone), clean(q.filter.Class), q.filter.MinLevel, q.filter.MaxLevel)
+}
+
+// parseWhoQuery decodes the args of a custom id made by customID
+func parseWhoQuery(args string) (whoQuery, error) {
+	q := whoQuery{}
+	fields := strings.Split(args, "|")
+	if len(fields) != 6 {
+		return q, fmt.Errorf("expected 6 fields, got %d", len(fields))
+	}
+	var err error
+	q.page, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return q, fmt.Errorf("page: %w", err)
+	}
+	q.filter.Name = fields[1]
+	q.filter.Zone = fields[2]
+	q.filter.Class = fields[3]
+	q.filter.MinLevel, err = strconv.Atoi(fields[4])
+	if err != nil {
+		return q, fmt.Errorf("min level: %w", err)
+	}
+	q.filter.MaxLevel, err = strconv.Atoi(fields[5])
+	if err != nil {
+		return q, fmt.Errorf("max level: %w", err)
+	}
+	return q, nil
+}
+
+// world is a telnet world /who reports on
+type world struct {
+	name string
+	db   *characterdb.DB
+}
+
+// AddWorld adds a world's characters to /who, and syncs role_sync roles each time they refresh.
+// name is shown with the world's players, and can be empty if there is only one world
+func (t *Discord) AddWorld(name string, db *characterdb.DB) {
+	t.worldsMu.Lock()
+	defer t.worldsMu.Unlock()
+	t.worlds = append(t.worlds, world{name: name, db: db})
+	db.OnRefresh(func() {
+		// telnet refreshes db while reading, so don't hold it up with discord requests
+		go t.syncRoles(db)
+	})
 }
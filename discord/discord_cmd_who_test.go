@@ -0,0 +1,73 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/xackery/talkeq/characterdb"
+	"github.com/xackery/talkeq/split"
+)
+
+func TestDiscord_whoPage(t *testing.T) {
+	characters := map[string]*characterdb.Character{}
+	for i := 0; i < 45; i++ {
+		name := fmt.Sprintf("Player%02d", i)
+		characters[name] = &characterdb.Character{Name: name, Level: 60, Class: "Warrior", Zone: "soldungb"}
+	}
+	db := characterdb.New()
+	db.SetCharacters(characters)
+	d := &Discord{}
+	d.AddWorld("", db)
+
+	data := d.whoPage(whoQuery{filter: characterdb.Filter{Zone: "soldungb"}, page: 1})
+	if !strings.HasPrefix(data.Content, "There are 45 players online who match zone 'soldungb', page 2 of 3:\nPlayer20 (60 Warrior) in soldungb\n") {
+		t.Fatalf("unexpected content %q", data.Content)
+	}
+	if strings.Count(data.Content, "\n") != whoPageSize {
+		t.Fatalf("expected %d players on the page: %q", whoPageSize, data.Content)
+	}
+
+	buttons := data.Components[0].(discordgo.ActionsRow).Components
+	next := buttons[1].(discordgo.Button)
+	name, args, _ := strings.Cut(next.CustomID, "|")
+	if name != "who" {
+		t.Fatalf("unexpected custom id %s", next.CustomID)
+	}
+	query, err := parseWhoQuery(args)
+	if err != nil {
+		t.Fatalf("parse %s: %s", next.CustomID, err)
+	}
+	if query.page != 2 || query.filter.Zone != "soldungb" {
+		t.Fatalf("unexpected next query %+v", query)
+	}
+
+	data = d.whoPage(query)
+	if !strings.Contains(data.Content, "page 3 of 3") || !data.Components[0].(discordgo.ActionsRow).Components[1].(discordgo.Button).Disabled {
+		t.Fatalf("expected the last page with next disabled: %+v", data)
+	}
+
+	// long zone names fill a page before whoPageSize players do
+	characters = map[string]*characterdb.Character{}
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("Player%02d", i)
+		characters[name] = &characterdb.Character{Name: name, Level: 60, Class: "Warrior", Zone: strings.Repeat("z", 150)}
+	}
+	db.SetCharacters(characters)
+	players := 0
+	for page := 0; ; page++ {
+		data = d.whoPage(whoQuery{page: page})
+		if utf8.RuneCountInString(data.Content) > split.DiscordMaxLength {
+			t.Fatalf("page %d is %d characters, longer than discord allows", page+1, utf8.RuneCountInString(data.Content))
+		}
+		players += strings.Count(data.Content, "\n")
+		if data.Components[0].(discordgo.ActionsRow).Components[1].(discordgo.Button).Disabled {
+			break
+		}
+	}
+	if players != 30 {
+		t.Fatalf("expected all 30 players across the pages, got %d", players)
+	}
+}
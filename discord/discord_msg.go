@@ -3,16 +3,24 @@ package discord
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/xackery/talkeq/config"
 	"github.com/xackery/talkeq/guilddb"
+	"github.com/xackery/talkeq/ratelimit"
 	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/router"
+	"github.com/xackery/talkeq/split"
 	"github.com/xackery/talkeq/tlog"
 	"github.com/xackery/talkeq/userdb"
 )
 
+// errTooLong is returned when a message would be split into more than telnet_max_parts lines in game
+var errTooLong = errors.New("message is too long")
+
 func (t *Discord) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	ctx := context.Background()
 	t.mu.Lock()
@@ -35,9 +43,6 @@ func (t *Discord) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate
 		tlog.Debugf("[discord] message too small, ignoring, original message: %s", originalMessage)
 		return
 	}
-	if len(msg) > 4000 {
-		msg = msg[0:4000]
-	}
 	msg = sanitize(msg)
 	if len(msg) < 1 {
 		tlog.Debugf("[discord] message after sanitize too small, ignoring, original message: %s", originalMessage)
@@ -58,6 +63,11 @@ func (t *Discord) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate
 		tlog.Debugf("[discord] bot %s ignored (message: %s)", m.Author.ID, msg)
 		return
 	}
+	// relays sent through our webhooks are not from the bot's account
+	if m.WebhookID != "" && t.isWebhook(m.WebhookID) {
+		tlog.Debugf("[discord] webhook %s ignored (message: %s)", m.WebhookID, msg)
+		return
+	}
 
 	ign = sanitize(ign)
 
@@ -112,6 +122,10 @@ func (t *Discord) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate
 		}
 	}
 	routes := 0
+	// roles are only looked up once a route's filter requires them
+	var roles []string
+	// a message too long for several routes is only pointed out once
+	isToldTooLong := false
 	for routeIndex, route := range t.config.Routes {
 		if !route.IsEnabled {
 			continue
@@ -122,40 +136,80 @@ func (t *Discord) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate
 		if isUnregisteredIGN && !route.IsAnyoneAllowed {
 			continue
 		}
+		err = route.Filter.Check(ign, msg)
+		if err != nil {
+			tlog.Debugf("[discord] route %d filtered: %s", routeIndex, err)
+			continue
+		}
+		if len(route.Filter.RequiredRoles) > 0 && roles == nil {
+			roles, err = t.memberRoles(s, m.GuildID, m.Author.ID)
+			if err != nil {
+				tlog.Warnf("[discord] route %d roles: %s", routeIndex, err)
+				roles = []string{}
+			}
+		}
+		err = route.Filter.CheckUser(m.Author.ID, roles)
+		if err != nil {
+			tlog.Debugf("[discord] route %d filtered: %s", routeIndex, err)
+			continue
+		}
 
-		buf := new(bytes.Buffer)
-
-		if err := route.MessagePatternTemplate().Execute(buf, struct {
-			Name      string
-			Message   string
-			ChannelID string
-		}{
-			ign,
-			msg,
-			route.ChannelID,
-		}); err != nil {
+		texts, err := t.render(&route, ign, msg)
+		if errors.Is(err, errTooLong) {
+			tlog.Infof("[discord] route %d not relayed: %s", routeIndex, err)
+			if !isToldTooLong {
+				isToldTooLong = true
+				t.tellTooLong(s, m, err)
+			}
+			continue
+		}
+		if err != nil {
 			tlog.Warnf("[discord] execute route %d failed: %s", routeIndex, err)
 			continue
 		}
 
 		routes++
-		switch route.Target {
-		case "telnet":
-			req := request.TelnetSend{
-				Ctx:     ctx,
-				Message: buf.String(),
+		reqs := []request.Message{}
+		for _, text := range texts {
+			req, err := router.Request(ctx, "discord", route.Target, route.ChannelID, text)
+			if err != nil {
+				tlog.Warnf("[discord] route %d failed: %s", routeIndex, err)
+				break
 			}
-			for _, s := range t.subscribers {
-				err := s(req)
+			reqs = append(reqs, req)
+		}
+		if len(reqs) != len(texts) {
+			continue
+		}
+		// send runs later if the rate limit queues it
+		routeIndex, target := routeIndex, route.Target
+		subscribers := t.subscribers
+		send := func() {
+			for i, req := range reqs {
+				for _, s := range subscribers {
+					err := s(req)
+					if err != nil {
+						tlog.Warnf("[discord->%s] route %d message '%s' failed: %s", target, routeIndex, texts[i], err)
+						continue
+					}
+					tlog.Infof("[discord->%s] route %d: %s", target, routeIndex, texts[i])
+				}
+			}
+		}
+		wait, err := ratelimit.DoParts(route.RateLimitKey(), ign, texts, route.RateLimit, send)
+		if err != nil {
+			tlog.Infof("[discord] route %d limited: %s", routeIndex, err)
+			var limitErr *ratelimit.LimitError
+			if errors.As(err, &limitErr) && limitErr.IsNotify {
+				_, err = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("<@%s> your message was not relayed: %s", m.Author.ID, limitErr.Reason))
 				if err != nil {
-					tlog.Warnf("[discord->telnet] route %d message '%s' failed: %s", routeIndex, req.Message, err)
-					continue
+					tlog.Warnf("[discord] route %d notify %s failed: %s", routeIndex, m.Author.ID, err)
 				}
-				tlog.Infof("[discord->telnet] route %d: %s", routeIndex, req.Message)
 			}
-
-		default:
-			tlog.Warnf("[discord] route %d failed: target %s is invalid", routeIndex, route.Target)
+			continue
+		}
+		if wait > 0 {
+			tlog.Debugf("[discord] route %d queued for %s", routeIndex, wait)
 		}
 	}
 	//check if channel is a guild one
@@ -163,20 +217,97 @@ func (t *Discord) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate
 	if guildID > 0 {
 		routes++
 
-		req := request.TelnetSend{
-			Ctx:     ctx,
-			Message: fmt.Sprintf("guildsay %s %d %s", ign, guildID, msg),
+		prefix := fmt.Sprintf("guildsay %s %d ", ign, guildID)
+		parts, err := t.splitTelnet(msg, len(prefix))
+		if err != nil {
+			tlog.Infof("[discord] guildID %d not relayed: %s", guildID, err)
+			if !isToldTooLong {
+				t.tellTooLong(s, m, err)
+			}
+			parts = nil
 		}
-		for i, s := range t.subscribers {
-			err := s(req)
-			if err != nil {
-				tlog.Warnf("[discord->subscriber %d] guildID %d message %s failed: %s", i, guildID, req.Message, err)
-				continue
+		for _, part := range parts {
+			req := request.TelnetSend{
+				Ctx:     ctx,
+				Message: prefix + part,
+			}
+			for i, s := range t.subscribers {
+				err := s(req)
+				if err != nil {
+					tlog.Warnf("[discord->subscriber %d] guildID %d message %s failed: %s", i, guildID, req.Message, err)
+					continue
+				}
+				tlog.Infof("[discord->subscriber %d] guildID %d message: %s", i, guildID, req.Message)
 			}
-			tlog.Infof("[discord->subscriber %d] guildID %d message: %s", i, guildID, req.Message)
 		}
 	}
 	if routes == 0 {
 		tlog.Debugf("[discord] message discarded, not routes match")
 	}
 }
+
+// render executes a route's message pattern. A message to telnet that would render longer than telnet_max_length
+// is split, and the pattern executed for each part, so every line in game keeps e.g. its emote prefix
+func (t *Discord) render(route *config.DiscordRoute, ign string, msg string) ([]string, error) {
+	text, err := execute(route, ign, msg)
+	if err != nil {
+		return nil, err
+	}
+	service, _ := config.SplitTarget(route.Target)
+	if service != "telnet" || len(text) <= t.config.TelnetMaxLength {
+		return []string{text}, nil
+	}
+	pattern, err := execute(route, ign, "")
+	if err != nil {
+		return nil, err
+	}
+	parts, err := t.splitTelnet(msg, len(pattern))
+	if err != nil {
+		return nil, err
+	}
+	texts := []string{}
+	for _, part := range parts {
+		text, err := execute(route, ign, part)
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+	}
+	return texts, nil
+}
+
+// splitTelnet splits msg into lines for telnet, leaving room for reserved characters of pattern on each.
+// Returns errTooLong if msg needs more than telnet_max_parts lines
+func (t *Discord) splitTelnet(msg string, reserved int) ([]string, error) {
+	parts := split.Split(msg, t.config.TelnetMaxLength-reserved)
+	if t.config.TelnetMaxParts > 0 && len(parts) > t.config.TelnetMaxParts {
+		return nil, fmt.Errorf("%w, it is %d lines in game and telnet_max_parts is %d", errTooLong, len(parts), t.config.TelnetMaxParts)
+	}
+	return parts, nil
+}
+
+// tellTooLong lets the author of m know their message was not relayed in game
+func (t *Discord) tellTooLong(s *discordgo.Session, m *discordgo.MessageCreate, err error) {
+	_, err = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("<@%s> your message was not relayed: %s", m.Author.ID, err))
+	if err != nil {
+		tlog.Warnf("[discord] notify %s failed: %s", m.Author.ID, err)
+	}
+}
+
+// execute renders a route's message pattern with msg
+func execute(route *config.DiscordRoute, ign string, msg string) (string, error) {
+	buf := new(bytes.Buffer)
+	err := route.MessagePatternTemplate().Execute(buf, struct {
+		Name      string
+		Message   string
+		ChannelID string
+	}{
+		ign,
+		msg,
+		route.ChannelID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,125 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/xackery/talkeq/characterdb"
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/guilddb"
+	"github.com/xackery/talkeq/tlog"
+	"github.com/xackery/talkeq/userdb"
+)
+
+// syncRoles adds and removes the role_sync roles of users registered to characters online in db.
+// A user's roles are only looked up when the roles their character should have change, e.g. on a level up past a min_level.
+// Anonymous and roleplaying characters are skipped, and users keep their roles while offline
+func (t *Discord) syncRoles(db *characterdb.DB) {
+	t.mu.RLock()
+	cfg := t.config.RoleSync
+	serverID := t.config.ServerID
+	isConnected := t.isConnected
+	conn := t.conn
+	t.mu.RUnlock()
+	if !cfg.IsEnabled || len(cfg.Roles) == 0 || !isConnected {
+		return
+	}
+
+	// a who dump can arrive while the last one is still syncing
+	t.rolesMu.Lock()
+	defer t.rolesMu.Unlock()
+
+	characters, _ := db.Online(characterdb.Filter{})
+	for _, c := range characters {
+		userID := userdb.DiscordID(c.Name)
+		if userID == "" {
+			continue
+		}
+		wanted := wantedRoles(cfg.Roles, c.Class, c.Level, guilddb.NameGuildID(c.Guild))
+		if !t.isRoleSyncNeeded(userID, wanted) {
+			continue
+		}
+		err := syncMemberRoles(conn, serverID, userID, cfg.Roles, wanted, c.Name)
+		if err != nil {
+			tlog.Warnf("[discord] sync roles of %s (%s): %s", userID, c.Name, err)
+			continue
+		}
+		t.syncedRoles[userID] = wanted
+	}
+}
+
+// isRoleSyncNeeded returns true if userID wasn't already synced to have the wanted roles. The caller must hold t.rolesMu
+func (t *Discord) isRoleSyncNeeded(userID string, wanted map[string]bool) bool {
+	if t.syncedRoles == nil {
+		t.syncedRoles = make(map[string]map[string]bool)
+	}
+	synced, ok := t.syncedRoles[userID]
+	return !ok || !reflect.DeepEqual(synced, wanted)
+}
+
+// syncMemberRoles updates one member's roles to match wanted
+func syncMemberRoles(conn *discordgo.Session, serverID string, userID string, rules []config.DiscordRole, wanted map[string]bool, name string) error {
+	member, err := conn.GuildMember(serverID, userID)
+	if err != nil {
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeUnknownMember {
+			tlog.Debugf("[discord] skipping roles of %s (%s), they are not in the server", userID, name)
+			return nil
+		}
+		return fmt.Errorf("guildMember: %w", err)
+	}
+
+	add, remove := roleChanges(rules, wanted, member.Roles)
+	for _, roleID := range add {
+		err = conn.GuildMemberRoleAdd(serverID, userID, roleID)
+		if err != nil {
+			return fmt.Errorf("guildMemberRoleAdd %s (does the bot have the manage roles permission, and a role above it?): %w", roleID, err)
+		}
+	}
+	for _, roleID := range remove {
+		err = conn.GuildMemberRoleRemove(serverID, userID, roleID)
+		if err != nil {
+			return fmt.Errorf("guildMemberRoleRemove %s (does the bot have the manage roles permission, and a role above it?): %w", roleID, err)
+		}
+	}
+	if len(add) > 0 || len(remove) > 0 {
+		tlog.Infof("[discord] roles of %s (%s) synced, added %s, removed %s", userID, name, strings.Join(add, ", "), strings.Join(remove, ", "))
+	}
+	return nil
+}
+
+// wantedRoles returns whether a character of class, level and guildID, from the guilds database, should have each role the rules list
+func wantedRoles(rules []config.DiscordRole, class string, level int, guildID int) map[string]bool {
+	wanted := map[string]bool{}
+	for _, rule := range rules {
+		wanted[rule.RoleID] = wanted[rule.RoleID] || rule.Match(class, level, guildID)
+	}
+	return wanted
+}
+
+// roleChanges returns which wanted roles a member with current roles is missing, and which they have but are no longer wanted, in rule order.
+// Roles no rule mentions are left alone
+func roleChanges(rules []config.DiscordRole, wanted map[string]bool, current []string) (add []string, remove []string) {
+	has := map[string]bool{}
+	for _, roleID := range current {
+		has[roleID] = true
+	}
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		roleID := rule.RoleID
+		if seen[roleID] {
+			continue
+		}
+		seen[roleID] = true
+		if wanted[roleID] && !has[roleID] {
+			add = append(add, roleID)
+		}
+		if !wanted[roleID] && has[roleID] {
+			remove = append(remove, roleID)
+		}
+	}
+	return add, remove
+}
@@ -0,0 +1,60 @@
+package discord
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xackery/talkeq/config"
+)
+
+func TestRoleChanges(t *testing.T) {
+	rules := []config.DiscordRole{
+		{RoleID: "sk", Class: "shadow knight"},
+		{RoleID: "60", MinLevel: 60},
+		{RoleID: "tank", Class: "Warrior"},
+		{RoleID: "tank", Class: "Shadow Knight", MinLevel: 50},
+		{RoleID: "guild", GuildID: 12},
+	}
+	tests := []struct {
+		name       string
+		class      string
+		level      int
+		guildID    int
+		current    []string
+		wantAdd    []string
+		wantRemove []string
+	}{
+		{"new member", "Shadow Knight", 60, 12, []string{"other"}, []string{"sk", "60", "tank", "guild"}, nil},
+		{"already synced", "Shadow Knight", 55, 0, []string{"sk", "tank"}, nil, nil},
+		{"left guild and changed class", "Monk", 60, 3, []string{"sk", "60", "tank", "guild", "other"}, nil, []string{"sk", "tank", "guild"}},
+		{"too low for either tank rule", "Shadow Knight", 10, 0, []string{"tank"}, []string{"sk"}, []string{"tank"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			add, remove := roleChanges(rules, wantedRoles(rules, tt.class, tt.level, tt.guildID), tt.current)
+			if !reflect.DeepEqual(add, tt.wantAdd) {
+				t.Fatalf("add = %v, want %v", add, tt.wantAdd)
+			}
+			if !reflect.DeepEqual(remove, tt.wantRemove) {
+				t.Fatalf("remove = %v, want %v", remove, tt.wantRemove)
+			}
+		})
+	}
+}
+
+func TestDiscord_isRoleSyncNeeded(t *testing.T) {
+	rules := []config.DiscordRole{
+		{RoleID: "60", MinLevel: 60},
+	}
+	d := &Discord{}
+	if !d.isRoleSyncNeeded("1", wantedRoles(rules, "Warrior", 58, 0)) {
+		t.Fatalf("expected a user that was never synced to need a sync")
+	}
+	d.syncedRoles["1"] = wantedRoles(rules, "Warrior", 58, 0)
+	if d.isRoleSyncNeeded("1", wantedRoles(rules, "Warrior", 59, 0)) {
+		t.Fatalf("expected a level up that changes no roles to skip the lookup")
+	}
+	if !d.isRoleSyncNeeded("1", wantedRoles(rules, "Warrior", 60, 0)) {
+		t.Fatalf("expected a level up past min_level to need a sync")
+	}
+}
@@ -0,0 +1,78 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/request"
+)
+
+// TestDiscord_SetConfigRace reloads config while messages are sent, run with -race
+func TestDiscord_SetConfigRace(t *testing.T) {
+	d, err := New(context.Background(), config.Discord{})
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			d.SetConfig(config.Discord{IsEnabled: i%2 == 0, BotStatus: "EQ"})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			d.Send(request.DiscordSend{ChannelID: "1", Message: "hello"})
+			d.EditMessage("1", "2", "hello")
+			d.SendDM(request.DiscordDM{Character: "Xackery", Message: "hello"})
+			d.LastSentMessage()
+			d.StatusUpdate(context.Background(), nil, "")
+		}
+	}()
+	wg.Wait()
+}
+
+func TestDiscord_splitTelnet(t *testing.T) {
+	d := &Discord{config: config.Discord{TelnetMaxLength: 40, TelnetMaxParts: 2}}
+	parts, err := d.splitTelnet("a message that fits in two lines", 10)
+	if err != nil || len(parts) != 2 {
+		t.Fatalf("got %d parts: %v", len(parts), err)
+	}
+	_, err = d.splitTelnet(strings.Repeat("flood ", 20), 10)
+	if !errors.Is(err, errTooLong) {
+		t.Fatalf("got %v, wanted a paste over telnet_max_parts to be too long", err)
+	}
+}
+
+func TestDiscord_SetConfigTell(t *testing.T) {
+	d, err := New(context.Background(), config.Discord{})
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	if _, ok := d.commands["tell"]; ok {
+		t.Fatalf("expected no /tell while tell is disabled")
+	}
+
+	cfg := config.Discord{}
+	cfg.Tell.IsEnabled = true
+	if d.SetConfig(cfg) {
+		t.Fatalf("expected enabling tell to not need a reconnect")
+	}
+	for _, name := range []string{"who", "tell", "tells"} {
+		if _, ok := d.commands[name]; !ok {
+			t.Fatalf("expected /%s once tell is enabled", name)
+		}
+	}
+
+	d.SetConfig(config.Discord{})
+	if _, ok := d.commands["tells"]; ok {
+		t.Fatalf("expected /tells removed once tell is disabled")
+	}
+}
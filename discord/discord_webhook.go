@@ -0,0 +1,126 @@
+package discord
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/xackery/talkeq/characterdb"
+	"github.com/xackery/talkeq/tlog"
+	"github.com/xackery/talkeq/tmplfunc"
+)
+
+// webhookName is the name of the webhook talkeq makes in each channel it relays to with webhook set
+const webhookName = "talkeq"
+
+// sendWebhook sends a message through the channel's webhook, so it appears from username
+func (t *Discord) sendWebhook(conn *discordgo.Session, avatarPattern string, channelID string, username string, params *discordgo.WebhookParams) (*discordgo.Message, error) {
+	params.Username = username
+	params.AvatarURL = t.avatarURL(avatarPattern, username)
+	for attempt := 0; ; attempt++ {
+		wh, err := t.webhook(conn, channelID)
+		if err != nil {
+			return nil, fmt.Errorf("webhook: %w", err)
+		}
+		msg, err := conn.WebhookExecute(wh.ID, wh.Token, true, params)
+		if err == nil {
+			return msg, nil
+		}
+		var restErr *discordgo.RESTError
+		if attempt > 0 || !errors.As(err, &restErr) || restErr.Message == nil || restErr.Message.Code != discordgo.ErrCodeUnknownWebhook {
+			return nil, fmt.Errorf("execute: %w", err)
+		}
+		// someone deleted the webhook, make a new one
+		tlog.Debugf("[discord] webhook for channel %s was deleted, recreating it", channelID)
+		t.webhooksMu.Lock()
+		delete(t.webhooks, channelID)
+		t.webhooksMu.Unlock()
+	}
+}
+
+// webhook returns the channel's talkeq webhook, reusing one made before or creating it
+func (t *Discord) webhook(conn *discordgo.Session, channelID string) (*discordgo.Webhook, error) {
+	t.mu.RLock()
+	botID := t.id
+	t.mu.RUnlock()
+
+	t.webhooksMu.Lock()
+	defer t.webhooksMu.Unlock()
+	if t.webhooks == nil {
+		t.webhooks = make(map[string]*discordgo.Webhook)
+	}
+	wh, ok := t.webhooks[channelID]
+	if ok {
+		return wh, nil
+	}
+
+	webhooks, err := conn.ChannelWebhooks(channelID)
+	if err != nil {
+		return nil, fmt.Errorf("channelWebhooks (does the bot have the manage webhooks permission?): %w", err)
+	}
+	for _, existing := range webhooks {
+		if existing.Name != webhookName || existing.Token == "" || existing.User == nil || existing.User.ID != botID {
+			continue
+		}
+		t.webhooks[channelID] = existing
+		return existing, nil
+	}
+
+	wh, err = conn.WebhookCreate(channelID, webhookName, "")
+	if err != nil {
+		return nil, fmt.Errorf("webhookCreate (does the bot have the manage webhooks permission?): %w", err)
+	}
+	tlog.Infof("[discord] created webhook for channel %s", channelID)
+	t.webhooks[channelID] = wh
+	return wh, nil
+}
+
+// isWebhook returns true if webhookID is a webhook talkeq relays through
+func (t *Discord) isWebhook(webhookID string) bool {
+	t.webhooksMu.Lock()
+	defer t.webhooksMu.Unlock()
+	for _, wh := range t.webhooks {
+		if wh.ID == webhookID {
+			return true
+		}
+	}
+	return false
+}
+
+// avatarURL renders avatarURL, the webhook_avatar_url pattern, for an online character, e.g. by class or race.
+// Empty if it isn't set, or the character isn't online, so discord uses the webhook's avatar
+func (t *Discord) avatarURL(avatarURL string, name string) string {
+	if avatarURL == "" {
+		return ""
+	}
+	c, ok := t.character(name)
+	if !ok {
+		return ""
+	}
+	tmpl, err := tmplfunc.New("avatar").Parse(avatarURL)
+	if err != nil {
+		tlog.Warnf("[discord] parse webhook_avatar_url: %s", err)
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	err = tmpl.Execute(buf, c)
+	if err != nil {
+		tlog.Warnf("[discord] execute webhook_avatar_url: %s", err)
+		return ""
+	}
+	return buf.String()
+}
+
+// character looks up an online character in every world /who reports on
+func (t *Discord) character(name string) (characterdb.Character, bool) {
+	t.worldsMu.RLock()
+	defer t.worldsMu.RUnlock()
+	for _, w := range t.worlds {
+		c, ok := w.db.Character(name)
+		if ok {
+			return c, true
+		}
+	}
+	return characterdb.Character{}, false
+}
@@ -1,20 +1,24 @@
 package eqlog
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"regexp"
 	"sync"
 
-	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/auction"
+	"github.com/xackery/talkeq/ratelimit"
+	"github.com/xackery/talkeq/router"
 	"github.com/xackery/talkeq/tlog"
 
 	"github.com/hpcloud/tail"
 	"github.com/xackery/talkeq/config"
 )
 
+// generalRegex matches general chat, which is relayed as an auction if convert_general_auction is set
+var generalRegex = regexp.MustCompile(`(\w+) says to general, '(.*)'`)
+
 // EQLog represents a eqlog connection
 type EQLog struct {
 	ctx         context.Context
@@ -53,6 +57,73 @@ func New(ctx context.Context, config config.EQLog) (*EQLog, error) {
 	return t, nil
 }
 
+// SetConfig swaps in a new configuration, such as routes, without restarting the tail.
+// Returns true if the path changed and eqlog needs to reconnect for it to apply
+func (t *EQLog) SetConfig(cfg config.EQLog) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	isReconnect := t.config.IsEnabled != cfg.IsEnabled ||
+		t.config.Path != cfg.Path
+	t.config = cfg
+	return isReconnect
+}
+
+// relay sends each routed result to its target
+func (t *EQLog) relay(ctx context.Context, results []router.Result) {
+	for _, result := range results {
+		if result.Err != nil {
+			tlog.Warnf("[eqlog] route %d skipped: %s", result.Index, result.Err)
+			continue
+		}
+		if result.Filtered != nil {
+			continue
+		}
+		route := result.Route
+		req, err := result.Request(ctx, "eqlog")
+		if err != nil {
+			tlog.Warnf("[eqlog] route %d skipped: %s", result.Index, err)
+			continue
+		}
+		// send runs later if the rate limit queues it
+		result := result
+		subscribers := t.subscribers
+		send := func() {
+			for i, s := range subscribers {
+				err := s(req)
+				if err != nil {
+					tlog.Warnf("[eqlog->%s subscriber %d] channelID %s message %s failed: %s", route.Target, i, route.ChannelID, result.Text, err)
+					continue
+				}
+				tlog.Infof("[eqlog->%s subscriber %d] channelID %s message: %s", route.Target, i, route.ChannelID, result.Text)
+			}
+		}
+		wait, err := ratelimit.Do(route.RateLimitKey("eqlog"), result.Name, result.Text, route.RateLimit, send)
+		if err != nil {
+			tlog.Infof("[eqlog] route %d limited: %s", result.Index, err)
+			continue
+		}
+		if wait > 0 {
+			tlog.Debugf("[eqlog] route %d queued for %s", result.Index, wait)
+		}
+	}
+}
+
+// Replay matches line against routes the same way as a line written to the eqlog file, without relaying it
+func (t *EQLog) Replay(line string) []router.Result {
+	t.mutex.RLock()
+	routes := t.config.Routes
+	isAuctionConverted := t.config.IsGeneralChatAuctionEnabled
+	t.mutex.RUnlock()
+	if isAuctionConverted {
+		var isAuction bool
+		line, isAuction = auction.Convert(line, generalRegex, "%s auctions, '%s'")
+		if isAuction {
+			tlog.Debugf("[eqlog] general message is an auction, relaying as one: %s", line)
+		}
+	}
+	return router.Match(routes, line, router.Options{Source: "eqlog"})
+}
+
 // IsConnected returns if a connection is established
 func (t *EQLog) IsConnected() bool {
 	t.mutex.RLock()
@@ -107,78 +178,36 @@ func (t *EQLog) loop(ctx context.Context) {
 		return
 	}
 
-	for line := range tailer.Lines {
+	defer func() {
+		tailer.Stop()
+		tailer.Cleanup()
+	}()
+
+	for {
+		var line *tail.Line
 		select {
 		case <-t.ctx.Done():
 			tlog.Debugf("[eqlog] exiting loop")
 			return
-		default:
+		case line = <-tailer.Lines:
 		}
-
-		for routeIndex, route := range t.config.Routes {
-			if !route.IsEnabled {
-				continue
-			}
-			pattern, err := regexp.Compile(route.Trigger.Regex)
-			if err != nil {
-				tlog.Debugf("[eqlog] route %d compile failed: %s", routeIndex, err)
-				continue
-			}
-			matches := pattern.FindAllStringSubmatch(line.Text, -1)
-			if len(matches) == 0 {
-				continue
-			}
-
-			name := ""
-			message := ""
-			if route.Trigger.MessageIndex >= len(matches[0]) {
-				message = matches[0][route.Trigger.MessageIndex]
-			}
-			if route.Trigger.NameIndex >= len(matches[0]) {
-				name = matches[0][route.Trigger.NameIndex]
-			}
-
-			buf := new(bytes.Buffer)
-			if err := route.MessagePatternTemplate().Execute(buf, struct {
-				Name    string
-				Message string
-			}{
-				name,
-				message,
-			}); err != nil {
-				tlog.Warnf("[eqlog] execute route %d: %s", routeIndex, err)
-				continue
-			}
-			switch route.Target {
-			case "discord":
-				req := request.DiscordSend{
-					Ctx:       ctx,
-					ChannelID: route.ChannelID,
-					Message:   buf.String(),
-				}
-				for _, s := range t.subscribers {
-					err = s(req)
-					if err != nil {
-						tlog.Warnf("[eqlog->discord subscriber %d] discordSend channelID %s message %s failed: %s", route.ChannelID, req.Message, err)
-						continue
-					}
-					tlog.Infof("[eqlog->discord subscriber %d] message: %s", route.ChannelID, req.Message)
-				}
-			default:
-				tlog.Warnf("[eqlog] unsupported target type: %s", route.Target)
-				continue
-			}
+		if line == nil {
+			tlog.Warnf("[eqlog] tail closed")
+			t.Disconnect(ctx)
+			return
 		}
+		if line.Err != nil {
+			tlog.Warnf("[eqlog] tail failed: %s", line.Err)
+			continue
+		}
+
+		t.relay(ctx, t.Replay(line.Text))
 	}
 }
 
 // Disconnect stops a previously started connection with EQLog.
 // If called while a connection is not active, returns nil
 func (t *EQLog) Disconnect(ctx context.Context) error {
-	if !t.config.IsEnabled {
-		tlog.Debugf("[eqlog] is disabled, skipping disconnect")
-		return nil
-	}
 	if !t.isConnected {
 		tlog.Debugf("[eqlog] is already disconnected, skipping disconnect")
 		return nil
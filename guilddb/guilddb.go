@@ -14,8 +14,10 @@ import (
 )
 
 var (
-	isStarted          bool
-	guilds             map[int]string
+	isStarted bool
+	guilds    map[int]string
+	// names has the EQ name of guilds whose line has one, e.g. 12:channelid:Dark Harvest
+	names              map[int]string
 	mu                 sync.RWMutex
 	guildsDatabasePath string
 )
@@ -30,7 +32,7 @@ func New(config *config.Config) error {
 	tlog.Debugf("[guilddb] initializing")
 	_, err := os.Stat(guildsDatabasePath)
 	if os.IsNotExist(err) {
-		err = ioutil.WriteFile(guildsDatabasePath, []byte(`# guildid:channelid #comment`), 0644)
+		err = ioutil.WriteFile(guildsDatabasePath, []byte(`# guildid:channelid:guild name #comment, the guild name is optional`), 0644)
 		if err != nil {
 			return fmt.Errorf("guilds database create %w", err)
 		}
@@ -96,6 +98,7 @@ func reload() error {
 	}
 
 	ng := make(map[int]string)
+	nn := make(map[int]string)
 	lines := strings.Split(string(data), "\n")
 	for lineNumber, line := range lines {
 		lineNumber++
@@ -134,6 +137,10 @@ func reload() error {
 			name = name[0:p]
 		}
 		name = strings.TrimSpace(name)
+		if channelID, guildName, ok := strings.Cut(name, ":"); ok {
+			name = strings.TrimSpace(channelID)
+			nn[id] = strings.TrimSpace(guildName)
+		}
 		_, ok := ng[id]
 		if ok {
 			tlog.Debugf("[guilddb] line %d skipped, guildID %d is a duplicate entry", lineNumber, id)
@@ -142,6 +149,7 @@ func reload() error {
 	}
 
 	guilds = ng
+	names = nn
 	return nil
 }
 
@@ -170,3 +178,18 @@ func GuildID(channelID string) int {
 	}
 	return 0
 }
+
+// NameGuildID returns the EQ guildID of a guild based on its name, ignoring case, returns 0 if no results
+func NameGuildID(name string) int {
+	if name == "" {
+		return 0
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for guildID, guildName := range names {
+		if strings.EqualFold(name, guildName) {
+			return guildID
+		}
+	}
+	return 0
+}
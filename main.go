@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/xackery/talkeq/client"
+	"github.com/xackery/talkeq/config"
 	"github.com/xackery/talkeq/tlog"
 )
 
@@ -15,7 +18,30 @@ import (
 var Version string
 
 func main() {
-	w, err := os.Create("talkeq.log")
+	configPath := flag.String("config", "talkeq.conf", "path to the configuration file, created if it does not exist")
+	logPath := flag.String("log", "talkeq.log", "path to write the log file to")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: talkeq [flags] [validate | replay <telnet[:name]|eqlog|peqeditorsql> <file>]\n\nvalidate checks the config for problems without connecting anywhere\nreplay prints what each line of a saved transcript would relay, without connecting anywhere\n\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "":
+	case "validate":
+		os.Exit(validate(*configPath))
+	case "replay":
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(replay(*configPath, flag.Arg(1), flag.Arg(2)))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	w, err := os.Create(*logPath)
 	if err != nil {
 		fmt.Println(err)
 		if runtime.GOOS == "windows" {
@@ -28,7 +54,7 @@ func main() {
 	defer w.Close()
 	tlog.Init(w, os.Stdout)
 
-	err = run(w)
+	err = run(*configPath)
 	if err != nil {
 		tlog.Errorf("run failed with error: %s", err)
 		if runtime.GOOS == "windows" {
@@ -44,7 +70,7 @@ func main() {
 	os.Exit(0)
 }
 
-func run(w *os.File) (err error) {
+func run(configPath string) (err error) {
 
 	if Version == "" {
 		Version = "1.x.x EXPERIMENTAL"
@@ -60,9 +86,10 @@ func run(w *os.File) (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
-	c, err := client.New(ctx)
+	tlog.Infof("using config %s", configPath)
+	c, err := client.New(ctx, configPath)
 	if err != nil {
 		return fmt.Errorf("new client: %w", err)
 	}
@@ -74,12 +101,32 @@ func run(w *os.File) (err error) {
 
 	select {
 	case <-ctx.Done():
-	case <-signalChan:
+	case sig := <-signalChan:
+		tlog.Infof("received %s signal, exiting", sig)
 		err = c.Disconnect(ctx)
 		if err != nil {
 			return fmt.Errorf("signal disconnect: %w", err)
 		}
-		tlog.Infof("exiting, interrupt signal sent")
 	}
 	return
 }
+
+// validate reports any problems found in the config at configPath, returning the exit code
+func validate(configPath string) int {
+	cfg, err := config.Decode(configPath)
+	if err != nil {
+		fmt.Printf("%s: %s\n", configPath, err)
+		return 1
+	}
+
+	problems := config.Validate(cfg)
+	if len(problems) == 0 {
+		fmt.Printf("%s: no problems found\n", configPath)
+		return 0
+	}
+	fmt.Printf("%s: %d problems found\n", configPath, len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	return 1
+}
@@ -0,0 +1,319 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/tlog"
+)
+
+// Outbox is a disk backed queue of messages waiting on an offline endpoint
+type Outbox struct {
+	mu      sync.Mutex
+	target  string
+	path    string
+	maxAge  time.Duration
+	maxSize int
+	records []record
+}
+
+type record struct {
+	Kind    string          `json:"kind"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// New creates or loads the outbox of target, stored inside dir
+func New(dir string, target string, maxAge time.Duration, maxSize int) (*Outbox, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("mkdir: %w", err)
+	}
+	// targets such as telnet:live are stored as telnet_live, since : isn't allowed in windows file names
+	o := &Outbox{
+		target:  target,
+		path:    filepath.Join(dir, strings.ReplaceAll(target, ":", "_")+".jsonl"),
+		maxAge:  maxAge,
+		maxSize: maxSize,
+	}
+	err = o.load()
+	if err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+	if len(o.records) > 0 {
+		tlog.Infof("[outbox] %s has %d queued messages waiting", target, len(o.records))
+	}
+	return o, nil
+}
+
+// Len returns how many messages are queued
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.records)
+}
+
+// Send delivers msg using send. If the endpoint is not connected, or older messages are still waiting
+// and can't be replayed yet, msg is queued instead so messages are always relayed in order
+func (o *Outbox) Send(msg request.Message, isConnected func() bool, send func(request.Message) error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.records) > 0 && isConnected() {
+		err := o.replay(isConnected, send)
+		if err != nil {
+			tlog.Warnf("[outbox] %s replay stopped: %s", o.target, err)
+		}
+	}
+
+	if len(o.records) == 0 && isConnected() {
+		err := send(msg)
+		if err == nil {
+			return nil
+		}
+		if isConnected() {
+			return err
+		}
+		tlog.Debugf("[outbox] %s send failed while disconnected, queueing: %s", o.target, err)
+	}
+
+	err := o.push(msg)
+	if err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	tlog.Infof("[outbox] %s is offline, queued message (%d waiting)", o.target, len(o.records))
+	return nil
+}
+
+// Replay relays queued messages in order using send, stopping once the endpoint is no longer connected.
+// A message that fails while the endpoint stays connected won't succeed later, so it is moved to the
+// dead letter file instead of blocking the messages behind it. Messages older than the outbox max age are discarded
+func (o *Outbox) Replay(isConnected func() bool, send func(request.Message) error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.replay(isConnected, send)
+}
+
+func (o *Outbox) replay(isConnected func() bool, send func(request.Message) error) error {
+	if len(o.records) == 0 || !isConnected() {
+		return nil
+	}
+
+	total := len(o.records)
+	expired := o.expire()
+	sent := 0
+	failed := 0
+	var sendErr error
+	for len(o.records) > 0 {
+		r := o.records[0]
+		msg, err := decode(r)
+		if err != nil {
+			tlog.Warnf("[outbox] %s discarding queued message: %s", o.target, err)
+			o.records = o.records[1:]
+			continue
+		}
+		err = send(msg)
+		if err != nil && !isConnected() {
+			sendErr = err
+			break
+		}
+		o.records = o.records[1:]
+		if err != nil {
+			failed++
+			tlog.Warnf("[outbox] %s dead lettering queued message that failed while connected: %s", o.target, err)
+			err = o.deadLetter(r)
+			if err != nil {
+				tlog.Warnf("[outbox] %s dead letter: %s", o.target, err)
+			}
+			continue
+		}
+		sent++
+	}
+
+	err := o.save()
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	tlog.Infof("[outbox] %s replayed %d of %d queued messages (%d expired, %d failed)", o.target, sent, total, expired, failed)
+	if sendErr != nil {
+		return fmt.Errorf("send: %w", sendErr)
+	}
+	return nil
+}
+
+// expire discards records older than the outbox max age, returning how many were discarded
+func (o *Outbox) expire() int {
+	if o.maxAge <= 0 {
+		return 0
+	}
+	records := o.records[:0]
+	for _, r := range o.records {
+		if time.Since(r.Created) > o.maxAge {
+			continue
+		}
+		records = append(records, r)
+	}
+	expired := len(o.records) - len(records)
+	o.records = records
+	return expired
+}
+
+func (o *Outbox) push(msg request.Message) error {
+	r, err := encode(msg)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	expired := o.expire()
+	if expired > 0 {
+		tlog.Infof("[outbox] %s discarded %d messages older than max age", o.target, expired)
+	}
+	o.records = append(o.records, r)
+	dropped := 0
+	if o.maxSize > 0 && len(o.records) > o.maxSize {
+		dropped = len(o.records) - o.maxSize
+		o.records = o.records[dropped:]
+		tlog.Warnf("[outbox] %s is full, discarded %d oldest messages", o.target, dropped)
+	}
+	if expired > 0 || dropped > 0 {
+		return o.save()
+	}
+	return o.appendRecord(o.path, r)
+}
+
+// deadLetter keeps a message that can't be delivered in the target's .dead.jsonl file, so it can be looked at later
+func (o *Outbox) deadLetter(r record) error {
+	return o.appendRecord(strings.TrimSuffix(o.path, ".jsonl")+".dead.jsonl", r)
+}
+
+// appendRecord adds r to the end of the file at path
+func (o *Outbox) appendRecord(path string, r record) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (o *Outbox) load() error {
+	data, err := os.ReadFile(o.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		r := record{}
+		err = json.Unmarshal(line, &r)
+		if err != nil {
+			tlog.Warnf("[outbox] %s line %d skipped: %s", o.path, lineNumber, err)
+			continue
+		}
+		o.records = append(o.records, r)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	return nil
+}
+
+// save rewrites the outbox file with the records still queued
+func (o *Outbox) save() error {
+	buf := new(bytes.Buffer)
+	for _, r := range o.records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	tmpPath := o.path + ".tmp"
+	err := os.WriteFile(tmpPath, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	err = os.Rename(tmpPath, o.path)
+	if err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+func encode(msg request.Message) (record, error) {
+	r := record{
+		Created: time.Now(),
+	}
+	switch msg.(type) {
+	case request.DiscordSend:
+		r.Kind = "discord_send"
+	case request.DiscordEdit:
+		r.Kind = "discord_edit"
+	case request.DiscordDM:
+		r.Kind = "discord_dm"
+	case request.TelnetSend:
+		r.Kind = "telnet_send"
+	default:
+		return r, fmt.Errorf("unsupported request %T", msg)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return r, fmt.Errorf("marshal: %w", err)
+	}
+	r.Data = data
+	return r, nil
+}
+
+func decode(r record) (request.Message, error) {
+	ctx := context.Background()
+	switch r.Kind {
+	case "discord_send":
+		req := request.DiscordSend{}
+		err := json.Unmarshal(r.Data, &req)
+		req.Ctx = ctx
+		return req, err
+	case "discord_edit":
+		req := request.DiscordEdit{}
+		err := json.Unmarshal(r.Data, &req)
+		req.Ctx = ctx
+		return req, err
+	case "discord_dm":
+		req := request.DiscordDM{}
+		err := json.Unmarshal(r.Data, &req)
+		req.Ctx = ctx
+		return req, err
+	case "telnet_send":
+		req := request.TelnetSend{}
+		err := json.Unmarshal(r.Data, &req)
+		req.Ctx = ctx
+		return req, err
+	}
+	return nil, fmt.Errorf("unknown kind %s", r.Kind)
+}
@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xackery/talkeq/request"
+)
+
+func TestOutbox_Replay(t *testing.T) {
+	dir := t.TempDir()
+	o, err := New(dir, "discord", time.Hour, 2)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	isConnected := false
+	sent := []string{}
+	send := func(msg request.Message) error {
+		if !isConnected {
+			return fmt.Errorf("not connected")
+		}
+		sent = append(sent, msg.(request.DiscordSend).Message)
+		return nil
+	}
+
+	for _, text := range []string{"first", "second", "third"} {
+		err = o.Send(request.DiscordSend{ChannelID: "1", Message: text}, func() bool { return isConnected }, send)
+		if err != nil {
+			t.Fatalf("send %s: %s", text, err)
+		}
+	}
+	if o.Len() != 2 {
+		t.Fatalf("wanted 2 queued after max size, got %d", o.Len())
+	}
+
+	// a restart should pick up what is on disk
+	o, err = New(dir, "discord", time.Hour, 2)
+	if err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+	if o.Len() != 2 {
+		t.Fatalf("wanted 2 queued after reload, got %d", o.Len())
+	}
+
+	isConnected = true
+	err = o.Replay(func() bool { return isConnected }, send)
+	if err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+	if len(sent) != 2 || sent[0] != "second" || sent[1] != "third" {
+		t.Fatalf("unexpected replay order: %v", sent)
+	}
+	if o.Len() != 0 {
+		t.Fatalf("wanted empty outbox, got %d", o.Len())
+	}
+}
+
+func TestOutbox_SendReplaysAndDeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	o, err := New(dir, "telnet:live", time.Hour, 10)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	isConnected := false
+	sent := []string{}
+	send := func(msg request.Message) error {
+		text := msg.(request.TelnetSend).Message
+		if !isConnected {
+			return fmt.Errorf("not connected")
+		}
+		if text == "bad" {
+			return fmt.Errorf("rejected")
+		}
+		sent = append(sent, text)
+		return nil
+	}
+	connected := func() bool { return isConnected }
+
+	for _, text := range []string{"first", "bad", "second"} {
+		err = o.Send(request.TelnetSend{Message: text}, connected, send)
+		if err != nil {
+			t.Fatalf("send %s: %s", text, err)
+		}
+	}
+	if o.Len() != 3 {
+		t.Fatalf("wanted 3 queued, got %d", o.Len())
+	}
+
+	// reconnecting without a replay, e.g. discordgo reconnecting on its own, should still flush the queue first
+	isConnected = true
+	err = o.Send(request.TelnetSend{Message: "third"}, connected, send)
+	if err != nil {
+		t.Fatalf("send third: %s", err)
+	}
+	want := []string{"first", "second", "third"}
+	if fmt.Sprint(sent) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", sent, want)
+	}
+	if o.Len() != 0 {
+		t.Fatalf("wanted empty outbox, got %d", o.Len())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "telnet_live.dead.jsonl"))
+	if err != nil {
+		t.Fatalf("read dead letters: %s", err)
+	}
+	if !strings.Contains(string(data), `"bad"`) {
+		t.Fatalf("wanted bad in dead letters, got %s", data)
+	}
+}
+
+func TestOutbox_ExpireOnPush(t *testing.T) {
+	o, err := New(t.TempDir(), "discord", time.Hour, 10)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	disconnected := func() bool { return false }
+	send := func(msg request.Message) error { return fmt.Errorf("not connected") }
+	err = o.Send(request.DiscordSend{ChannelID: "1", Message: "old"}, disconnected, send)
+	if err != nil {
+		t.Fatalf("send old: %s", err)
+	}
+	o.records[0].Created = time.Now().Add(-2 * time.Hour)
+	err = o.Send(request.DiscordSend{ChannelID: "1", Message: "new"}, disconnected, send)
+	if err != nil {
+		t.Fatalf("send new: %s", err)
+	}
+	if o.Len() != 1 {
+		t.Fatalf("wanted the old message expired, got %d queued", o.Len())
+	}
+}
@@ -1,15 +1,14 @@
 package peqeditorsql
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
-	"regexp"
 	"sync"
 	"time"
 
-	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/ratelimit"
+	"github.com/xackery/talkeq/router"
 	"github.com/xackery/talkeq/tlog"
 
 	"github.com/hpcloud/tail"
@@ -59,6 +58,18 @@ func New(ctx context.Context, config config.PEQEditorSQL) (*PEQEditorSQL, error)
 	return t, nil
 }
 
+// SetConfig swaps in a new configuration, such as routes, without restarting the tail.
+// Returns true if the log location changed and peqeditorsql needs to reconnect for it to apply
+func (t *PEQEditorSQL) SetConfig(cfg config.PEQEditorSQL) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	isReconnect := t.config.IsEnabled != cfg.IsEnabled ||
+		t.config.Path != cfg.Path ||
+		t.config.FilePattern != cfg.FilePattern
+	t.config = cfg
+	return isReconnect
+}
+
 // IsConnected returns if a connection is established
 func (t *PEQEditorSQL) IsConnected() bool {
 	t.mutex.RLock()
@@ -153,10 +164,6 @@ func (t *PEQEditorSQL) loop(ctx context.Context) {
 // Disconnect stops a previously started connection with PEQEditorSQL.
 // If called while a connection is not active, returns nil
 func (t *PEQEditorSQL) Disconnect(ctx context.Context) error {
-	if !t.config.IsEnabled {
-		tlog.Debugf("[peqeditorsql] is disabled, skipping disconnect")
-		return nil
-	}
 	if !t.isConnected {
 		//tlog.Debugf("[peqeditorsql] already disconnected, skipping disconnect")
 		return nil
@@ -179,62 +186,52 @@ func (t *PEQEditorSQL) Subscribe(ctx context.Context, onMessage func(interface{}
 	return nil
 }
 
+// Replay matches line against routes the same way as a line written to the peq editor sql log, without relaying it
+func (t *PEQEditorSQL) Replay(line string) []router.Result {
+	t.mutex.RLock()
+	routes := t.config.Routes
+	t.mutex.RUnlock()
+	return router.Match(routes, line, router.Options{Source: "peqeditorsql"})
+}
+
 func (t *PEQEditorSQL) handleMessage(ctx context.Context, line string) {
 	isSent := false
-	for routeIndex, route := range t.config.Routes {
-		if !route.IsEnabled {
+	for _, result := range t.Replay(line) {
+		if result.Err != nil {
+			tlog.Warnf("[peqeditorsql] route %d skipped: %s", result.Index, result.Err)
 			continue
 		}
-		pattern, err := regexp.Compile(route.Trigger.Regex)
-		if err != nil {
-			tlog.Debugf("[peqeditorsql] compile route %d skipped: %s", routeIndex, err)
+		if result.Filtered != nil {
 			continue
 		}
-		matches := pattern.FindAllStringSubmatch(line, -1)
-		if len(matches) == 0 {
-			continue
-		}
-
-		name := ""
-		message := ""
-		if route.Trigger.MessageIndex > 0 && route.Trigger.MessageIndex <= len(matches[0]) {
-			message = matches[0][route.Trigger.MessageIndex]
-		}
-		if route.Trigger.NameIndex > 0 && route.Trigger.NameIndex <= len(matches[0]) {
-			name = matches[0][route.Trigger.NameIndex]
-		}
-
-		buf := new(bytes.Buffer)
-		if err := route.MessagePatternTemplate().Execute(buf, struct {
-			Name    string
-			Message string
-		}{
-			name,
-			message,
-		}); err != nil {
-			tlog.Warnf("[peqeditorsql] execute route %d skipped: %s", routeIndex, err)
+		route := result.Route
+		req, err := result.Request(ctx, "peqeditorsql")
+		if err != nil {
+			tlog.Warnf("[peqeditorsql] route %d skipped: %s", result.Index, err)
 			continue
 		}
-		switch route.Target {
-		case "discord":
-			req := request.DiscordSend{
-				Ctx:       ctx,
-				ChannelID: route.ChannelID,
-				Message:   buf.String(),
-			}
-			for i, s := range t.subscribers {
-				err = s(req)
+		// send runs later if the rate limit queues it
+		result := result
+		subscribers := t.subscribers
+		send := func() {
+			for i, s := range subscribers {
+				err := s(req)
 				if err != nil {
-					tlog.Warnf("[peqeditorsql->discord subscriber %d] channel %s message %s failed: %s", i, route.ChannelID, req.Message)
+					tlog.Warnf("[peqeditorsql->%s subscriber %d] channel %s message %s failed: %s", route.Target, i, route.ChannelID, result.Text, err)
 					continue
 				}
-				tlog.Infof("[peqeditorsql->discord subscribe %d] channel %s message: %s", i, route.ChannelID, req.Message)
+				tlog.Infof("[peqeditorsql->%s subscriber %d] channel %s message: %s", route.Target, i, route.ChannelID, result.Text)
 			}
-			isSent = true
-		default:
-			tlog.Warnf("[peqeditorsql] unsupported target type: %s", route.Target)
+		}
+		wait, err := ratelimit.Do(route.RateLimitKey("peqeditorsql"), result.Name, result.Text, route.RateLimit, send)
+		if err != nil {
+			tlog.Infof("[peqeditorsql] route %d limited: %s", result.Index, err)
 			continue
 		}
+		if wait > 0 {
+			tlog.Debugf("[peqeditorsql] route %d queued for %s", result.Index, wait)
+		}
+		isSent = true
 	}
 	if !isSent {
 		tlog.Debugf("[peqeditorsql] message '%s' was not sent (no route enabled)", line)
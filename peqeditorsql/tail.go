@@ -5,11 +5,11 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"text/template"
 	"time"
 
 	"github.com/hpcloud/tail"
 	"github.com/xackery/talkeq/tlog"
+	"github.com/xackery/talkeq/tmplfunc"
 )
 
 // tail wraps the tail tool for each file being watched
@@ -50,7 +50,7 @@ func (e *tailWatch) restart(msgChan chan string) error {
 	}
 	e.ctx, e.cancel = context.WithCancel(context.Background())
 	buf := new(bytes.Buffer)
-	tmpl := template.New("filePattern")
+	tmpl := tmplfunc.New("filePattern")
 	tmpl.Parse(e.req.filePattern)
 
 	month := time.Now().Format("01")
@@ -84,6 +84,7 @@ func (e *tailWatch) restart(msgChan chan string) error {
 func (e *tailWatch) loop(msgChan chan string) {
 	defer func() {
 		tlog.Debugf("[peqeditorsql] tail%s loop exiting for %s", e.req.id, e.tailer.Filename)
+		e.tailer.Stop()
 		e.tailer.Cleanup()
 	}()
 
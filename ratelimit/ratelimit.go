@@ -0,0 +1,289 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xackery/talkeq/config"
+)
+
+const (
+	// pruneInterval is how often idle buckets, old messages and counters are forgotten
+	pruneInterval = 10 * time.Minute
+	// counterMaxAge is how long a sender's counter is kept after they were last limited
+	counterMaxAge = 24 * time.Hour
+)
+
+var defaultLimiter = New()
+
+// LimitError is returned when a message is dropped by a rate limit
+type LimitError struct {
+	Reason string
+	// IsNotify is true if the sender should be told, it is only set the first time a sender is limited in a row
+	IsNotify bool
+}
+
+// Error returns the reason a message was limited
+func (e *LimitError) Error() string {
+	return e.Reason
+}
+
+// Counter is how often a sender was limited on a route
+type Counter struct {
+	Route       string    `json:"route"`
+	Sender      string    `json:"sender"`
+	Dropped     int       `json:"dropped"`
+	Queued      int       `json:"queued"`
+	Duplicates  int       `json:"duplicates"`
+	LastLimited time.Time `json:"last_limited"`
+}
+
+// Limiter throttles routes and their senders with token buckets, and suppresses duplicate messages
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	messages  map[string]message
+	notified  map[string]bool
+	counters  map[string]*Counter
+	lastPrune time.Time
+	now       func() time.Time
+	after     func(d time.Duration, f func())
+}
+
+type bucket struct {
+	tokens    float64
+	burst     float64
+	perSecond float64
+	last      time.Time
+}
+
+type message struct {
+	text   string
+	at     time.Time
+	window time.Duration
+}
+
+// New creates a new limiter
+func New() *Limiter {
+	return &Limiter{
+		buckets:  make(map[string]*bucket),
+		messages: make(map[string]message),
+		notified: make(map[string]bool),
+		counters: make(map[string]*Counter),
+		now:      time.Now,
+		after: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+}
+
+// Do calls send unless text from sender is limited on route, e.g. telnet.routes[ooc] from a route's RateLimitKey.
+// With the queue action, send may be called later, and the wait is returned.
+// A *LimitError is returned if the message was dropped
+func Do(route string, sender string, text string, cfg config.RateLimit, send func()) (time.Duration, error) {
+	return defaultLimiter.Do(route, sender, text, cfg, send)
+}
+
+// DoParts is Do for a message sent as several parts, e.g. a long discord message split over lines in game.
+// Each part counts against the limits, so a long paste can't flood more lines than the limit allows
+func DoParts(route string, sender string, parts []string, cfg config.RateLimit, send func()) (time.Duration, error) {
+	return defaultLimiter.DoParts(route, sender, parts, cfg, send)
+}
+
+// Counters returns how often each sender was limited on each route
+func Counters() []Counter {
+	return defaultLimiter.Counters()
+}
+
+// Do calls send unless text from sender is limited on route, e.g. telnet.routes[ooc] from a route's RateLimitKey.
+// With the queue action, send may be called later, and the wait is returned.
+// A *LimitError is returned if the message was dropped
+func (l *Limiter) Do(route string, sender string, text string, cfg config.RateLimit, send func()) (time.Duration, error) {
+	return l.do(route, sender, text, 1, cfg, send)
+}
+
+// DoParts is Do for a message sent as several parts, e.g. a long discord message split over lines in game.
+// Each part counts against the limits, so a long paste can't flood more lines than the limit allows
+func (l *Limiter) DoParts(route string, sender string, parts []string, cfg config.RateLimit, send func()) (time.Duration, error) {
+	return l.do(route, sender, strings.Join(parts, "\n"), len(parts), cfg, send)
+}
+
+// do calls send unless text, which uses cost tokens, is limited
+func (l *Limiter) do(route string, sender string, text string, cost int, cfg config.RateLimit, send func()) (time.Duration, error) {
+	if !cfg.IsEnabled() {
+		send()
+		return 0, nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	l.prune(now)
+
+	senderKey := route + "|" + sender
+	routeBucket := l.bucket(route, cfg.RoutePerMinute, cfg.RouteBurst, now)
+	senderBucket := l.bucket(senderKey, cfg.SenderPerMinute, cfg.SenderBurst, now)
+
+	window := cfg.DuplicateWindowDuration()
+	if window > 0 {
+		last, ok := l.messages[senderKey]
+		if ok && last.text == text && now.Sub(last.at) < window {
+			counter := l.counter(route, sender, now)
+			counter.Duplicates++
+			err := l.limited(cfg, senderKey, fmt.Sprintf("%s repeated a message within %s", sender, window))
+			l.mu.Unlock()
+			return 0, err
+		}
+	}
+
+	wait := time.Duration(0)
+	isQueueFull := false
+	for _, b := range []*bucket{routeBucket, senderBucket} {
+		if b == nil {
+			continue
+		}
+		// a message costing more than the burst goes once the bucket is full, and its debt is waited out after
+		need := math.Min(float64(cost), b.burst)
+		if b.tokens >= need {
+			continue
+		}
+		if b.tokens-need < -float64(cfg.MaxQueue) {
+			isQueueFull = true
+		}
+		limitWait := time.Duration((need - b.tokens) / b.perSecond * float64(time.Second))
+		if limitWait > wait {
+			wait = limitWait
+		}
+	}
+
+	if wait > 0 && (cfg.Action != config.RateLimitQueue || isQueueFull) {
+		counter := l.counter(route, sender, now)
+		counter.Dropped++
+		reason := fmt.Sprintf("%s is over the rate limit", sender)
+		if isQueueFull {
+			reason = fmt.Sprintf("%s is over the rate limit, and the queue is full", sender)
+		}
+		err := l.limited(cfg, senderKey, reason)
+		l.mu.Unlock()
+		return 0, err
+	}
+
+	for _, b := range []*bucket{routeBucket, senderBucket} {
+		if b != nil {
+			b.tokens -= float64(cost)
+		}
+	}
+	delete(l.notified, senderKey)
+	if window > 0 {
+		l.messages[senderKey] = message{text: text, at: now, window: window}
+	}
+	if wait > 0 {
+		l.counter(route, sender, now).Queued++
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		l.after(wait, send)
+		return wait, nil
+	}
+	send()
+	return 0, nil
+}
+
+// Counters returns how often each sender was limited on each route
+func (l *Limiter) Counters() []Counter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counters := []Counter{}
+	for _, counter := range l.counters {
+		counters = append(counters, *counter)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Route != counters[j].Route {
+			return counters[i].Route < counters[j].Route
+		}
+		return counters[i].Sender < counters[j].Sender
+	})
+	return counters
+}
+
+// bucket returns the refilled bucket for key, or nil if perMinute is unlimited
+func (l *Limiter) bucket(key string, perMinute int, burst int, now time.Time) *bucket {
+	if perMinute < 1 {
+		return nil
+	}
+	if burst < 1 {
+		burst = perMinute
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	// limits can change on a config reload
+	b.burst = float64(burst)
+	b.perSecond = float64(perMinute) / 60
+	b.refill(now)
+	return b
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.perSecond
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// limited builds the error for a dropped message, notifying only once until the sender is allowed again
+func (l *Limiter) limited(cfg config.RateLimit, senderKey string, reason string) error {
+	err := &LimitError{Reason: reason}
+	if cfg.Action != config.RateLimitNotify {
+		return err
+	}
+	err.IsNotify = !l.notified[senderKey]
+	l.notified[senderKey] = true
+	return err
+}
+
+func (l *Limiter) counter(route string, sender string, now time.Time) *Counter {
+	key := route + "|" + sender
+	counter, ok := l.counters[key]
+	if !ok {
+		counter = &Counter{Route: route, Sender: sender}
+		l.counters[key] = counter
+	}
+	counter.LastLimited = now
+	return counter
+}
+
+// prune forgets full buckets and messages outside their duplicate window, since they no longer limit anything,
+// and counters of senders who haven't been limited in a while
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.buckets, key)
+			delete(l.notified, key)
+		}
+	}
+	for key, m := range l.messages {
+		if now.Sub(m.at) >= m.window {
+			delete(l.messages, key)
+			delete(l.notified, key)
+		}
+	}
+	for key, counter := range l.counters {
+		if now.Sub(counter.LastLimited) >= counterMaxAge {
+			delete(l.counters, key)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xackery/talkeq/config"
+)
+
+func TestLimiter_Do(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	queued := []time.Duration{}
+	l := New()
+	l.now = func() time.Time { return now }
+	l.after = func(d time.Duration, f func()) {
+		queued = append(queued, d)
+		f()
+	}
+
+	sent := 0
+	send := func() { sent++ }
+
+	cfg := config.RateLimit{SenderPerMinute: 2, DuplicateWindow: "1m"}
+	err := cfg.Load()
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+
+	for _, text := range []string{"wts a", "wts b", "wts c"} {
+		l.Do("telnet.routes[0]", "Spammer", text, cfg, send)
+	}
+	if sent != 2 {
+		t.Fatalf("sent %d, wanted 2 within burst", sent)
+	}
+
+	_, err = l.Do("telnet.routes[0]", "Xackery", "hello", cfg, send)
+	if err != nil || sent != 3 {
+		t.Fatalf("expected another sender to have their own limit: %v", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	_, err = l.Do("telnet.routes[0]", "Spammer", "wts b", cfg, send)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected duplicate to be limited, got %v", err)
+	}
+	_, err = l.Do("telnet.routes[0]", "Spammer", "wts d", cfg, send)
+	if err != nil || sent != 4 {
+		t.Fatalf("expected a token to refill after 30s: %v", err)
+	}
+
+	cfg.Action = config.RateLimitQueue
+	wait, err := l.Do("telnet.routes[0]", "Spammer", "wts e", cfg, send)
+	if err != nil || wait != 30*time.Second || len(queued) != 1 || sent != 5 {
+		t.Fatalf("expected message to be queued for 30s, got wait %s: %v", wait, err)
+	}
+
+	counters := l.Counters()
+	if len(counters) != 1 {
+		t.Fatalf("got %d counters, wanted 1: %+v", len(counters), counters)
+	}
+	c := counters[0]
+	if c.Sender != "Spammer" || c.Dropped != 1 || c.Duplicates != 1 || c.Queued != 1 {
+		t.Fatalf("unexpected counter: %+v", c)
+	}
+}
+
+func TestLimiter_DoNotify(t *testing.T) {
+	l := New()
+	cfg := config.RateLimit{RoutePerMinute: 1, Action: config.RateLimitNotify}
+	send := func() {}
+
+	l.Do("discord.routes[0]", "Xackery", "a", cfg, send)
+	isNotified := []bool{}
+	for _, text := range []string{"b", "c"} {
+		_, err := l.Do("discord.routes[0]", "Xackery", text, cfg, send)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("expected %s to be limited, got %v", text, err)
+		}
+		isNotified = append(isNotified, limitErr.IsNotify)
+	}
+	if !isNotified[0] || isNotified[1] {
+		t.Fatalf("expected only the first limited message to notify, got %v", isNotified)
+	}
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New()
+	l.now = func() time.Time { return now }
+	cfg := config.RateLimit{SenderPerMinute: 1}
+	send := func() {}
+
+	for _, sender := range []string{"Xackery", "Shin"} {
+		l.Do("telnet.routes[ooc]", sender, "a", cfg, send)
+		l.Do("telnet.routes[ooc]", sender, "b", cfg, send)
+	}
+	if len(l.Counters()) != 2 || len(l.buckets) != 2 {
+		t.Fatalf("got %d counters and %d buckets, wanted 2 each", len(l.Counters()), len(l.buckets))
+	}
+
+	now = now.Add(counterMaxAge)
+	l.Do("telnet.routes[ooc]", "Rogean", "a", cfg, send)
+	if len(l.Counters()) != 0 || len(l.buckets) != 1 {
+		t.Fatalf("got %d counters and %d buckets, wanted idle senders forgotten", len(l.Counters()), len(l.buckets))
+	}
+}
+
+func TestLimiter_DoParts(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New()
+	l.now = func() time.Time { return now }
+	cfg := config.RateLimit{SenderPerMinute: 6, SenderBurst: 3}
+	sent := 0
+	send := func() { sent++ }
+
+	_, err := l.DoParts("discord.routes[ooc]", "Xackery", []string{"a (1/2)", "b (2/2)"}, cfg, send)
+	if err != nil || sent != 1 {
+		t.Fatalf("expected 2 parts within a burst of 3 to send: %v", err)
+	}
+	_, err = l.DoParts("discord.routes[ooc]", "Xackery", []string{"c (1/2)", "d (2/2)"}, cfg, send)
+	if err == nil {
+		t.Fatalf("expected 2 more parts to be over the 1 token left")
+	}
+
+	now = now.Add(time.Minute)
+	parts := []string{"1", "2", "3", "4", "5", "6"}
+	_, err = l.DoParts("discord.routes[ooc]", "Xackery", parts, cfg, send)
+	if err != nil || sent != 2 {
+		t.Fatalf("expected a paste longer than the burst to send once the bucket is full: %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	_, err = l.Do("discord.routes[ooc]", "Xackery", "e", cfg, send)
+	if err == nil {
+		t.Fatalf("expected the paste's 3 parts over the burst to be waited out first")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/eqlog"
+	"github.com/xackery/talkeq/guilddb"
+	"github.com/xackery/talkeq/peqeditorsql"
+	"github.com/xackery/talkeq/router"
+	"github.com/xackery/talkeq/telnet"
+)
+
+// replay feeds a saved transcript through a source's routes, printing what would be relayed. Returns the exit code
+func replay(configPath string, source string, path string) int {
+	err := runReplay(configPath, source, path)
+	if err != nil {
+		fmt.Printf("replay: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runReplay(configPath string, source string, path string) error {
+	ctx := context.Background()
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	err = guilddb.New(cfg)
+	if err != nil {
+		return fmt.Errorf("guilddb.New: %w", err)
+	}
+
+	// sources are created disabled so nothing is checked or opened, then given their real config
+	var match func(line string) []router.Result
+	service, instance := config.SplitTarget(source)
+	switch service {
+	case "telnet":
+		telnetConfig := cfg.Telnet
+		if instance != "" {
+			var ok bool
+			telnetConfig, ok = cfg.TelnetInstance(instance)
+			if !ok {
+				return fmt.Errorf("%s is not a telnet_instances name", instance)
+			}
+		}
+		t, err := telnet.New(ctx, config.Telnet{})
+		if err != nil {
+			return fmt.Errorf("telnet: %w", err)
+		}
+		t.SetConfig(telnetConfig)
+		match = t.Replay
+	case "eqlog":
+		t, err := eqlog.New(ctx, config.EQLog{})
+		if err != nil {
+			return fmt.Errorf("eqlog: %w", err)
+		}
+		t.SetConfig(cfg.EQLog)
+		match = t.Replay
+	case "peqeditorsql":
+		t, err := peqeditorsql.New(ctx, config.PEQEditorSQL{})
+		if err != nil {
+			return fmt.Errorf("peqeditorsql: %w", err)
+		}
+		t.SetConfig(cfg.PEQEditor.SQL)
+		match = t.Replay
+	default:
+		return fmt.Errorf("unknown source %s, expected telnet, telnet:<name>, eqlog or peqeditorsql", source)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	lineCount := 0
+	matchCount := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineCount++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		results := match(line)
+		if len(results) == 0 {
+			continue
+		}
+		matchCount++
+		fmt.Printf("line %d: %s\n", lineCount, line)
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Printf("  %s.routes[%d] skipped: %s\n", source, result.Index, result.Err)
+				continue
+			}
+			if result.Filtered != nil {
+				fmt.Printf("  %s.routes[%d] filtered: %s\n", source, result.Index, result.Filtered)
+				continue
+			}
+			fmt.Printf("  %s.routes[%d] -> %s channel %s: %s\n", source, result.Index, result.Route.Target, result.Route.ChannelID, result.Text)
+			if result.Embed != nil {
+				fmt.Printf("    embed by %s: %s %s (%d items)\n", result.Embed.Author, result.Embed.Title, result.Embed.Description, len(result.Embed.Fields))
+			}
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	fmt.Printf("%d of %d lines matched a route\n", matchCount, lineCount)
+	return nil
+}
@@ -2,25 +2,73 @@ package request
 
 import (
 	"context"
+	"time"
 )
 
+// Message is a request that can be delivered to a target endpoint
+type Message interface {
+	// Destination returns the name of the endpoint the message is delivered to
+	Destination() string
+}
+
 // DiscordSend Request
 type DiscordSend struct {
-	Ctx       context.Context
+	Ctx       context.Context `json:"-"`
 	ChannelID string
 	Message   string
+	// Embed, if set, is sent with Message, which can then be empty
+	Embed *Embed `json:",omitempty"`
+	// Username, if set, sends the message through the channel's webhook so it appears from Username, e.g. a character
+	Username string `json:",omitempty"`
+}
+
+// Embed is a discord embed
+type Embed struct {
+	Title       string
+	Description string
+	Color       int
+	Author      string
+	// AuthorURL links the author, e.g. to a character profile
+	AuthorURL string
+	Fields    []EmbedField
+	Footer    string
+	Timestamp time.Time
+}
+
+// EmbedField is a titled value in an embed, e.g. an item link
+type EmbedField struct {
+	Name     string
+	Value    string
+	IsInline bool
+}
+
+// Destination returns discord
+func (r DiscordSend) Destination() string { return "discord" }
+
+// DiscordDM is a direct message to the discord user registered to a character
+type DiscordDM struct {
+	Ctx       context.Context `json:"-"`
+	Character string
+	Message   string
 }
 
+// Destination returns discord
+func (r DiscordDM) Destination() string { return "discord" }
+
 // DiscordEdit Request
 type DiscordEdit struct {
-	Ctx       context.Context
+	Ctx       context.Context `json:"-"`
 	ChannelID string
+	MessageID string
 	Message   string
 }
 
+// Destination returns discord
+func (r DiscordEdit) Destination() string { return "discord" }
+
 // APICommand Request
 type APICommand struct {
-	Ctx                  context.Context
+	Ctx                  context.Context `json:"-"`
 	FromDiscordName      string
 	FromDiscordChannelID string
 	FromDiscordNameID    string
@@ -28,9 +76,23 @@ type APICommand struct {
 	Message              string
 }
 
+// Destination returns api
+func (r APICommand) Destination() string { return "api" }
+
+// APIEvent is a relayed message published on the API event stream
+type APIEvent struct {
+	Ctx       context.Context `json:"-"`
+	Source    string          `json:"source"`
+	ChannelID string          `json:"channel_id,omitempty"`
+	Message   string          `json:"message"`
+}
+
+// Destination returns api
+func (r APIEvent) Destination() string { return "api" }
+
 // EQLog originated from EQLog
 type EQLog struct {
-	Ctx                context.Context
+	Ctx                context.Context `json:"-"`
 	Action             string
 	Target             int
 	FromName           string
@@ -39,15 +101,28 @@ type EQLog struct {
 	ToName             string
 }
 
+// Destination returns discord, where ToDiscordChannelID is relayed to
+func (r EQLog) Destination() string { return "discord" }
+
 // TelnetSend request
 type TelnetSend struct {
-	Ctx     context.Context
-	Message string
+	Ctx context.Context `json:"-"`
+	// Instance is the name of a telnet_instances world to send to, empty for the default telnet
+	Instance string `json:",omitempty"`
+	Message  string
+}
+
+// Destination returns telnet, or telnet:<instance> for a named world
+func (r TelnetSend) Destination() string {
+	if r.Instance == "" {
+		return "telnet"
+	}
+	return "telnet:" + r.Instance
 }
 
 // PEQEditorSQL originated from PEQ Editor
 type PEQEditorSQL struct {
-	Ctx            context.Context
+	Ctx            context.Context `json:"-"`
 	Action         string
 	Target         int
 	FromName       string
@@ -55,3 +130,6 @@ type PEQEditorSQL struct {
 	ChannelKeyword string
 	ToName         string
 }
+
+// Destination returns api
+func (r PEQEditorSQL) Destination() string { return "api" }
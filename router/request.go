@@ -0,0 +1,39 @@
+package router
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/request"
+)
+
+// Request builds the message that relays text from source to a route's target.
+// Targets are discord, telnet, telnet:<name> for a telnet_instances world, or api for the API event stream
+func Request(ctx context.Context, source string, target string, channelID string, text string) (request.Message, error) {
+	service, instance := config.SplitTarget(target)
+	switch service {
+	case "discord":
+		return request.DiscordSend{
+			Ctx:       ctx,
+			ChannelID: channelID,
+			Message:   text,
+		}, nil
+	case "telnet":
+		return request.TelnetSend{
+			Ctx:      ctx,
+			Instance: instance,
+			Message:  text,
+		}, nil
+	case "api":
+		return request.APIEvent{
+			Ctx:       ctx,
+			Source:    source,
+			ChannelID: channelID,
+			Message:   text,
+		}, nil
+	case "dm":
+		return nil, fmt.Errorf("dm target needs a recipient, and is only supported by regex routes")
+	}
+	return nil, fmt.Errorf("unsupported target type: %s", target)
+}
@@ -0,0 +1,378 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/guilddb"
+	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/tlog"
+	"github.com/xackery/talkeq/tmplfunc"
+)
+
+// maxEmbedFields is the most fields discord shows in an embed
+const maxEmbedFields = 25
+
+var (
+	// now is replaced in tests
+	now = time.Now
+	// itemLinkRegexes caches itemLinkRegex for each item url
+	itemLinkRegexes sync.Map
+)
+
+// Result is a route that matched a line
+type Result struct {
+	// Index is the route's position in the source's routes
+	Index int
+	// Source is where the line came from, e.g. telnet:live
+	Source string
+	// Route is the matched route. If it has a guild_index, ChannelID is resolved from the guilds database
+	Route   config.Route
+	Name    string
+	Message string
+	// Recipient is the character a dm target relays to
+	Recipient string
+	// Groups has every named group of the trigger regex
+	Groups map[string]string
+	// Text is the route's message pattern rendered with Name, Message, Raw and Groups
+	Text string
+	// Embed is the route's embed, if it has one
+	Embed *request.Embed
+	// Err is set if the route matched, but its message could not be built
+	Err error
+	// Filtered is why the route's filter rejected the message, such results should not be relayed
+	Filtered error
+}
+
+// Options changes how a source's lines are matched
+type Options struct {
+	// Source is where lines come from, e.g. telnet or telnet:<name>. It is set on results and prefixes log messages
+	Source string
+	// FormatName, if set, rewrites a matched name before it is rendered, e.g. into a profile link
+	FormatName func(name string) string
+	// ItemURL and ProfileURL are where item and character links point.
+	// Their links are kept when a line is escaped for discord, and embeds list item links and link the author
+	ItemURL    string
+	ProfileURL string
+	// ItemNames are items the source showed as *Item Name* for lack of an ItemURL, that markup is kept when escaping
+	ItemNames []string
+}
+
+// Match returns a result for every enabled route that matches line, highest priority first.
+// A matching route with stop set ends matching, and only the first matching route of a group is returned.
+// Routes whose filter rejects the line are returned with Filtered set, and don't stop matching.
+// Routes with a custom trigger are skipped, since they are raised by events instead of lines
+func Match(routes []config.Route, line string, opts Options) []Result {
+	results := []Result{}
+	firedGroups := map[string]bool{}
+	for _, routeIndex := range order(routes) {
+		route := routes[routeIndex]
+		if !route.IsEnabled || route.Trigger.Custom != "" {
+			continue
+		}
+		if route.Group != "" && firedGroups[route.Group] {
+			continue
+		}
+		// most lines are skipped here, which is far cheaper than running the regex
+		literal := route.TriggerLiteral()
+		if literal != "" && !strings.Contains(line, literal) {
+			continue
+		}
+		pattern := route.TriggerRegex()
+		if pattern == nil {
+			tlog.Debugf("[%s] route %d regex %q does not compile", opts.Source, routeIndex, route.Trigger.Regex)
+			continue
+		}
+		matches := pattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		result, isRouted := match(routeIndex, route, pattern, line, matches, opts)
+		if !isRouted {
+			continue
+		}
+		results = append(results, result)
+		if result.Filtered != nil {
+			tlog.Debugf("[%s] route %d filtered: %s", opts.Source, routeIndex, result.Filtered)
+			continue
+		}
+		if route.Group != "" {
+			firedGroups[route.Group] = true
+		}
+		if route.IsStop {
+			break
+		}
+	}
+	return results
+}
+
+// Custom returns a result for every enabled route with a custom trigger of event, e.g. serverup.
+// Priority, stop and groups apply the same as Match
+func Custom(routes []config.Route, event string) []Result {
+	results := []Result{}
+	firedGroups := map[string]bool{}
+	for _, routeIndex := range order(routes) {
+		route := routes[routeIndex]
+		if !route.IsEnabled || route.Trigger.Custom != event {
+			continue
+		}
+		if route.Group != "" && firedGroups[route.Group] {
+			continue
+		}
+		result := Result{
+			Index: routeIndex,
+			Route: route,
+		}
+		buf := new(bytes.Buffer)
+		err := route.MessagePatternTemplate().Execute(buf, config.RouteMessage{
+			Groups: map[string]string{},
+		})
+		if err != nil {
+			result.Err = fmt.Errorf("execute: %w", err)
+		}
+		result.Text = buf.String()
+		results = append(results, result)
+		if route.Group != "" {
+			firedGroups[route.Group] = true
+		}
+		if route.IsStop {
+			break
+		}
+	}
+	return results
+}
+
+// order returns route indexes by priority, highest first. Routes with the same priority keep config order
+func order(routes []config.Route) []int {
+	indexes := make([]int, len(routes))
+	for i := range routes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return routes[indexes[i]].Priority > routes[indexes[j]].Priority
+	})
+	return indexes
+}
+
+// match builds the result of a matched route, returning false if the route should be skipped
+func match(routeIndex int, route config.Route, pattern *regexp.Regexp, line string, matches []string, opts Options) (Result, bool) {
+	result := Result{
+		Index:  routeIndex,
+		Source: opts.Source,
+		Route:  route,
+		Groups: map[string]string{},
+	}
+	for i, groupName := range pattern.SubexpNames() {
+		if groupName == "" {
+			continue
+		}
+		result.Groups[groupName] = matches[i]
+	}
+
+	var err error
+	result.Message, err = group(matches, "message_index", route.Trigger.MessageIndex)
+	if err != nil {
+		result.Err = err
+		return result, true
+	}
+	result.Name, err = group(matches, "name_index", route.Trigger.NameIndex)
+	if err != nil {
+		result.Err = err
+		return result, true
+	}
+
+	result.Recipient, err = group(matches, "recipient_index", route.Trigger.RecipientIndex)
+	if err != nil {
+		result.Err = err
+		return result, true
+	}
+
+	result.Filtered = route.Filter.Check(result.Name, result.Message)
+	if result.Filtered != nil {
+		return result, true
+	}
+
+	if route.Trigger.GuildIndex > 0 {
+		guildID, err := group(matches, "guild_index", route.Trigger.GuildIndex)
+		if err != nil {
+			result.Err = err
+			return result, true
+		}
+		result.Route.GuildID = guildID
+		iGuildID, err := strconv.Atoi(guildID)
+		if err != nil {
+			result.Err = fmt.Errorf("guild_index %s is not an integer", guildID)
+			return result, true
+		}
+		channelID := guilddb.ChannelID(iGuildID)
+		if channelID == "" {
+			if route.ChannelID == "INSERTGLOBALGUILDCHANNELHERE" {
+				return result, false //in cases a guild route happened and default settings, no need to attempt the route
+			}
+			tlog.Debugf("[%s] route %d guild %d is not in talkeq_guilds, falling back to channel %s", opts.Source, routeIndex, iGuildID, route.ChannelID)
+		} else {
+			result.Route.ChannelID = channelID
+		}
+	}
+
+	name := result.Name
+	if opts.FormatName != nil {
+		name = opts.FormatName(name)
+	}
+	data := config.RouteMessage{
+		Name:    name,
+		Message: result.Message,
+		Raw:     line,
+		Groups:  result.Groups,
+	}
+	service, _ := config.SplitTarget(route.Target)
+	if (service == "discord" || service == "dm") && !route.IsMarkdownAllowed {
+		data = escape(data, []string{opts.ItemURL, opts.ProfileURL}, opts.ItemNames)
+	}
+
+	buf := new(bytes.Buffer)
+	err = result.Route.MessagePatternTemplate().Execute(buf, data)
+	if err != nil {
+		result.Err = fmt.Errorf("execute: %w", err)
+		return result, true
+	}
+	result.Text = buf.String()
+
+	if service == "discord" && route.Embed.IsEnabled {
+		result.Embed, err = embed(&result, data, opts)
+		if err != nil {
+			result.Err = fmt.Errorf("embed: %w", err)
+		}
+	}
+	return result, true
+}
+
+// embed renders a result's embed. The author is the plain name, linked to opts.ProfileURL,
+// and every item link in the message is listed as a field.
+// Without a footer pattern, the footer is the EQ channel from a channel regex group, else the route's group, else the source
+func embed(result *Result, data config.RouteMessage, opts Options) (*request.Embed, error) {
+	data.Name = result.Name
+	text, err := result.Route.Embed.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	footer := text.Footer
+	if footer == "" {
+		footer = result.Groups["channel"]
+	}
+	if footer == "" {
+		footer = result.Route.Group
+	}
+	if footer == "" {
+		footer = opts.Source
+	}
+	e := &request.Embed{
+		Title:       text.Title,
+		Description: text.Description,
+		Color:       text.Color,
+		Author:      text.Author,
+		Footer:      footer,
+		Timestamp:   now(),
+		Fields:      []request.EmbedField{},
+	}
+	if opts.ProfileURL != "" && result.Name != "" {
+		e.AuthorURL = opts.ProfileURL + result.Name
+	}
+	if opts.ItemURL == "" {
+		return e, nil
+	}
+	for _, matches := range itemLinkRegex(opts.ItemURL).FindAllStringSubmatch(result.Message, maxEmbedFields) {
+		field := request.EmbedField{Name: matches[1], Value: matches[2], IsInline: true}
+		if field.Name == "" {
+			field.Name, field.Value = matches[4], matches[3]
+		}
+		e.Fields = append(e.Fields, field)
+	}
+	return e, nil
+}
+
+// itemLinkRegex returns a regex matching item links to itemURL that telnet made,
+// e.g. [Jboots](<https://...>) or https://... (Jboots)
+func itemLinkRegex(itemURL string) *regexp.Regexp {
+	cached, ok := itemLinkRegexes.Load(itemURL)
+	if ok {
+		return cached.(*regexp.Regexp)
+	}
+	url := regexp.QuoteMeta(itemURL)
+	pattern := regexp.MustCompile(`\[([^\]]+)\]\(<?(` + url + `[^)>\s]*)>?\)|<?(` + url + `[^\s>]*)>? \(([^)]+)\)`)
+	itemLinkRegexes.Store(itemURL, pattern)
+	return pattern
+}
+
+// Request builds the message that relays a result to its route's target. A dm target messages the recipient's discord user.
+// Discord messages get the result's embed, and are sent from the matched name if the route has webhook set
+func (r Result) Request(ctx context.Context, source string) (request.Message, error) {
+	if r.Route.Target == "dm" {
+		if r.Recipient == "" {
+			return nil, fmt.Errorf("dm target has no recipient, set recipient_index")
+		}
+		return request.DiscordDM{
+			Ctx:       ctx,
+			Character: r.Recipient,
+			Message:   r.Text,
+		}, nil
+	}
+	req, err := Request(ctx, source, r.Route.Target, r.Route.ChannelID, r.Text)
+	if err != nil {
+		return nil, err
+	}
+	discordReq, ok := req.(request.DiscordSend)
+	if !ok {
+		return req, nil
+	}
+	discordReq.Embed = r.Embed
+	if r.Route.IsWebhook {
+		discordReq.Username = r.Name
+	}
+	return discordReq, nil
+}
+
+// escape returns data with every player controlled field escaped for discord,
+// so only the markup of the route's message pattern, links to linkPrefixes and *Item Name* of itemNames are formatted
+func escape(data config.RouteMessage, linkPrefixes []string, itemNames []string) config.RouteMessage {
+	pairs := []string{}
+	for _, name := range itemNames {
+		escaped := tmplfunc.EscapeMarkdown(name)
+		pairs = append(pairs, `\*`+escaped+`\*`, "*"+escaped+"*")
+	}
+	items := strings.NewReplacer(pairs...)
+	field := func(value string) string {
+		return items.Replace(tmplfunc.EscapeMarkdownLinks(value, linkPrefixes...))
+	}
+
+	groups := map[string]string{}
+	for key, value := range data.Groups {
+		groups[key] = field(value)
+	}
+	return config.RouteMessage{
+		Name:    field(data.Name),
+		Message: field(data.Message),
+		Raw:     field(data.Raw),
+		Groups:  groups,
+	}
+}
+
+// group returns the regex group at index, 0 is ignored and returns an empty string
+func group(matches []string, key string, index int) (string, error) {
+	if index == 0 {
+		return "", nil
+	}
+	if index < 0 || index >= len(matches) {
+		return "", fmt.Errorf("%s %d is out of range, regex has %d groups", key, index, len(matches)-1)
+	}
+	return matches[index], nil
+}
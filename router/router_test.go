@@ -0,0 +1,253 @@
+package router
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xackery/talkeq/config"
+	"github.com/xackery/talkeq/request"
+)
+
+func TestMatch(t *testing.T) {
+	routes := []config.Route{
+		{
+			IsEnabled:      true,
+			Trigger:        config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:         "discord",
+			ChannelID:      "1",
+			MessagePattern: "{{.Name}} **OOC**: {{.Message}}",
+		},
+		{
+			Trigger:        config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:         "discord",
+			ChannelID:      "2",
+			MessagePattern: "disabled",
+		},
+		{
+			IsEnabled:      true,
+			Trigger:        config.Trigger{Regex: `(\w+) says ooc`, NameIndex: 1, MessageIndex: 2},
+			Target:         "discord",
+			ChannelID:      "3",
+			MessagePattern: "{{.Name}}",
+		},
+		{
+			IsEnabled:      true,
+			Trigger:        config.Trigger{Custom: "serverup"},
+			Target:         "discord",
+			ChannelID:      "4",
+			MessagePattern: "up",
+		},
+	}
+	for i := range routes {
+		err := routes[i].LoadMessagePattern()
+		if err != nil {
+			t.Fatalf("route %d: %s", i, err)
+		}
+	}
+
+	results := Match(routes, "Xackery says ooc, 'hello'", Options{
+		FormatName: strings.ToUpper,
+	})
+	if len(results) != 2 {
+		t.Fatalf("got %d results, wanted 2: %+v", len(results), results)
+	}
+	if results[0].Index != 0 || results[0].Err != nil || results[0].Text != "XACKERY **OOC**: hello" {
+		t.Fatalf("unexpected result 0: %+v", results[0])
+	}
+	if results[0].Name != "Xackery" || results[0].Message != "hello" {
+		t.Fatalf("unexpected result 0 groups: %+v", results[0])
+	}
+	if results[1].Index != 2 || results[1].Err == nil {
+		t.Fatalf("expected result 1 to fail with message_index out of range: %+v", results[1])
+	}
+
+	results = Match(routes, "Xackery shouts, 'hello'", Options{})
+	if len(results) != 0 {
+		t.Fatalf("got %d results, wanted 0", len(results))
+	}
+
+	boss := config.Route{
+		IsEnabled:      true,
+		Trigger:        config.Trigger{Regex: `(?P<killer>\w+) has killed (?P<boss>[\w ]+) in (?P<zone>\w+)`},
+		Target:         "discord",
+		ChannelID:      "5",
+		MessagePattern: "{{.Groups.killer}} slew {{.Groups.boss}} in {{.Groups.zone}} ({{.Raw}})",
+	}
+	results = Match([]config.Route{boss}, "Xackery has killed Lord Nagafen in soldungb", Options{})
+	if len(results) != 1 || results[0].Text != "Xackery slew Lord Nagafen in soldungb (Xackery has killed Lord Nagafen in soldungb)" {
+		t.Fatalf("unexpected named group result: %+v", results)
+	}
+	if results[0].Groups["zone"] != "soldungb" {
+		t.Fatalf("unexpected groups: %+v", results[0].Groups)
+	}
+
+	routes[0].Filter = config.Filter{DenyNames: []string{"xackery"}}
+	results = Match(routes, "Xackery says ooc, 'hello'", Options{})
+	if len(results) != 2 || results[0].Filtered == nil || results[0].Text != "" {
+		t.Fatalf("expected result 0 to be filtered before rendering: %+v", results)
+	}
+}
+
+func TestMatchPriority(t *testing.T) {
+	ooc := config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2}
+	wts := config.Trigger{Regex: `(\w+) says ooc, '(WTS .*)'`, NameIndex: 1, MessageIndex: 2}
+	routes := []config.Route{
+		{IsEnabled: true, Trigger: ooc, Target: "discord", ChannelID: "ooc", Group: "ooc"},
+		{IsEnabled: true, Trigger: wts, Target: "discord", ChannelID: "auction", Group: "ooc", Priority: 10},
+		{IsEnabled: true, Trigger: ooc, Target: "telnet", ChannelID: "260"},
+		{IsEnabled: true, Trigger: ooc, Target: "api", ChannelID: "log", Priority: -1},
+	}
+
+	channels := func(results []Result) string {
+		ids := []string{}
+		for _, result := range results {
+			ids = append(ids, result.Route.ChannelID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	got := channels(Match(routes, "Xackery says ooc, 'WTS Jboots'", Options{}))
+	if got != "auction,260,log" {
+		t.Fatalf("got %s, wanted the wts route to take over the ooc group", got)
+	}
+	got = channels(Match(routes, "Xackery says ooc, 'hello'", Options{}))
+	if got != "ooc,260,log" {
+		t.Fatalf("got %s, wanted the ooc route when wts doesn't match", got)
+	}
+
+	routes[2].IsStop = true
+	got = channels(Match(routes, "Xackery says ooc, 'hello'", Options{}))
+	if got != "ooc,260" {
+		t.Fatalf("got %s, wanted stop to skip lower priority routes", got)
+	}
+
+	routes[1].Filter = config.Filter{DenyNames: []string{"Xackery"}}
+	results := Match(routes, "Xackery says ooc, 'WTS Jboots'", Options{})
+	if len(results) != 3 || results[0].Filtered == nil || results[1].Route.ChannelID != "ooc" {
+		t.Fatalf("expected a filtered route not to take over its group: %+v", results)
+	}
+}
+
+func TestMatchEmbed(t *testing.T) {
+	now = func() time.Time { return time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	routes := []config.Route{
+		{
+			IsEnabled:      true,
+			Trigger:        config.Trigger{Regex: `(\w+) auctions, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:         "discord",
+			ChannelID:      "1",
+			MessagePattern: "",
+			Embed:          config.Embed{IsEnabled: true, Color: "#FF9900", Title: "Auction", Footer: "auction"},
+			IsWebhook:      true,
+		},
+	}
+	err := routes[0].Load()
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+
+	results := Match(routes, "Shin auctions, 'WTS [Jboots](<http://item.com?id=1>) 5k *cheap*'", Options{
+		Source:     "telnet",
+		ItemURL:    "http://item.com?id=",
+		ProfileURL: "http://char.com?name=",
+	})
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	want := &request.Embed{
+		Title:       "Auction",
+		Description: `WTS [Jboots](<http://item.com?id=1>) 5k \*cheap\*`,
+		Color:       0xFF9900,
+		Author:      "Shin",
+		AuthorURL:   "http://char.com?name=Shin",
+		Fields:      []request.EmbedField{{Name: "Jboots", Value: "http://item.com?id=1", IsInline: true}},
+		Footer:      "auction",
+		Timestamp:   now(),
+	}
+	if !reflect.DeepEqual(results[0].Embed, want) {
+		t.Fatalf("got %+v, want %+v", results[0].Embed, want)
+	}
+
+	req, err := results[0].Request(context.Background(), "telnet")
+	if err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	if req.(request.DiscordSend).Embed != results[0].Embed {
+		t.Fatalf("request is missing the embed: %+v", req)
+	}
+	if req.(request.DiscordSend).Username != "Shin" {
+		t.Fatalf("expected the webhook request to be from Shin: %+v", req)
+	}
+}
+
+func TestMatchEmbedFooter(t *testing.T) {
+	routes := []config.Route{
+		{
+			IsEnabled: true,
+			Trigger:   config.Trigger{Regex: `(\w+) says (?P<channel>ooc), '(.*)'`, NameIndex: 1, MessageIndex: 3},
+			Target:    "discord",
+			ChannelID: "1",
+			Embed:     config.Embed{IsEnabled: true},
+		},
+		{
+			IsEnabled: true,
+			Trigger:   config.Trigger{Regex: `(\w+) shouts, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:    "discord",
+			ChannelID: "2",
+			Group:     "shout",
+			Embed:     config.Embed{IsEnabled: true},
+		},
+		{
+			IsEnabled: true,
+			Trigger:   config.Trigger{Regex: `(\w+) auctions, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+			Target:    "discord",
+			ChannelID: "3",
+			Embed:     config.Embed{IsEnabled: true},
+		},
+	}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"Shin says ooc, 'hello'", "ooc"},
+		{"Shin shouts, 'hello'", "shout"},
+		{"Shin auctions, 'WTS Jboots'", "telnet:live"},
+	}
+	for _, tt := range tests {
+		results := Match(routes, tt.line, Options{Source: "telnet:live"})
+		if len(results) != 1 || results[0].Err != nil || results[0].Embed == nil {
+			t.Fatalf("%s: unexpected results: %+v", tt.line, results)
+		}
+		if results[0].Embed.Footer != tt.want {
+			t.Fatalf("%s: got footer %q, want %q", tt.line, results[0].Embed.Footer, tt.want)
+		}
+	}
+}
+
+func TestResultRequestDM(t *testing.T) {
+	routes := []config.Route{
+		{
+			IsEnabled:      true,
+			Trigger:        config.Trigger{Regex: `(\w+) tells (\w+), '(.*)'`, NameIndex: 1, RecipientIndex: 2, MessageIndex: 3},
+			Target:         "dm",
+			MessagePattern: "{{.Name}} tells you, '{{.Message}}'",
+		},
+	}
+	results := Match(routes, "Shin tells Xackery, '*inc*'", Options{})
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	req, err := results[0].Request(context.Background(), "telnet")
+	if err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	want := request.DiscordDM{Ctx: context.Background(), Character: "Xackery", Message: `Shin tells you, '\*inc\*'`}
+	if req != want {
+		t.Fatalf("got %+v, want %+v", req, want)
+	}
+}
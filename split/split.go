@@ -0,0 +1,85 @@
+package split
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	// DiscordMaxLength is the longest message discord accepts
+	DiscordMaxLength = 2000
+	// EQMaxLength is about the longest chat message EQ shows before cutting it off
+	EQMaxLength = 500
+)
+
+// wordRegex matches a word, keeping markdown links, e.g. [Mask of Tinkering](<https://...>), and raw EQ item links whole
+var wordRegex = regexp.MustCompile(`(?:\[[^\]\n]*\]\([^)\s]*\)|\x12[^\x12]*\x12|[^\s\[\x12]+|[\[\x12])+`)
+
+// Split breaks text into parts of at most max characters, on word boundaries and never inside a link.
+// When text is split, every part ends with a marker of its order, e.g. (1/3).
+// Only a word longer than a part is cut
+func Split(text string, max int) []string {
+	if max < 1 || length(text) <= max {
+		return []string{text}
+	}
+	for digits := 1; ; digits++ {
+		marker := len(" (/)") + 2*digits
+		if max <= marker {
+			return split(text, max)
+		}
+		parts := split(text, max-marker)
+		if len(strconv.Itoa(len(parts))) > digits {
+			continue
+		}
+		for i := range parts {
+			parts[i] += fmt.Sprintf(" (%d/%d)", i+1, len(parts))
+		}
+		return parts
+	}
+}
+
+// split breaks text into parts of at most max characters without markers
+func split(text string, max int) []string {
+	parts := []string{}
+	start := 0
+	end := 0
+	for _, word := range wordRegex.FindAllStringIndex(text, -1) {
+		if length(text[start:word[1]]) <= max {
+			end = word[1]
+			continue
+		}
+		if end > start {
+			parts = append(parts, text[start:end])
+		}
+		start = word[0]
+		// a word too long for any part is cut, e.g. a pasted wall of text without spaces
+		for length(text[start:word[1]]) > max {
+			cut := offset(text[start:], max)
+			parts = append(parts, text[start:start+cut])
+			start += cut
+		}
+		end = word[1]
+	}
+	if end > start {
+		parts = append(parts, text[start:end])
+	}
+	return parts
+}
+
+// length returns how many characters s has
+func length(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// offset returns the byte offset of the character at index in s
+func offset(s string, index int) int {
+	for i := range s {
+		if index == 0 {
+			return i
+		}
+		index--
+	}
+	return len(s)
+}
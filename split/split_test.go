@@ -0,0 +1,52 @@
+package split
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want []string
+	}{
+		{"short", "hello world", 20, []string{"hello world"}},
+		{"words", "aaaa bbbb cccc dddd", 15, []string{"aaaa bbbb (1/2)", "cccc dddd (2/2)"}},
+		{"link", "WTS [Mask of Tinkering](<http://a.com?i=1>) 5k obo", 48, []string{"WTS (1/3)", "[Mask of Tinkering](<http://a.com?i=1>) 5k (2/3)", "obo (3/3)"}},
+		{"eq link", "WTS \x12abc Mask of Tinkering\x12 5k obo", 32, []string{"WTS (1/3)", "\x12abc Mask of Tinkering\x12 5k (2/3)", "obo (3/3)"}},
+		{"long word", strings.Repeat("a", 20), 13, []string{"aaaaaaa (1/3)", "aaaaaaa (2/3)", "aaaaaa (3/3)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.max)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if len(part) > tt.max {
+					t.Fatalf("part %q is longer than %d", part, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestSplit_manyParts(t *testing.T) {
+	parts := Split(strings.Repeat("word ", 400), 20)
+	if len(parts) < 10 {
+		t.Fatalf("got %d parts, wanted at least 10", len(parts))
+	}
+	last := parts[len(parts)-1]
+	if !strings.HasSuffix(last, fmt.Sprintf(" (%d/%d)", len(parts), len(parts))) {
+		t.Fatalf("unexpected last part %q", last)
+	}
+	for _, part := range parts {
+		if len(part) > 20 {
+			t.Fatalf("part %q is longer than 20", part)
+		}
+	}
+}
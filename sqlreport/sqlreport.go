@@ -54,6 +54,20 @@ func New(ctx context.Context, config config.SQLReport, discClient *discord.Disco
 	return t, nil
 }
 
+// SetConfig swaps in a new configuration, such as report entries, without dropping the connection.
+// Returns true if connection settings changed and sqlreport needs to reconnect for them to apply
+func (t *SQLReport) SetConfig(cfg config.SQLReport) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	isReconnect := t.config.IsEnabled != cfg.IsEnabled ||
+		t.config.Host != cfg.Host ||
+		t.config.Username != cfg.Username ||
+		t.config.Password != cfg.Password ||
+		t.config.Database != cfg.Database
+	t.config = cfg
+	return isReconnect
+}
+
 // IsConnected returns if a connection is established
 func (t *SQLReport) IsConnected() bool {
 	t.mutex.RLock()
@@ -156,17 +170,18 @@ func (t *SQLReport) loop(ctx context.Context) {
 // Disconnect stops a previously started connection with SQLReport.
 // If called while a connection is not active, returns nil
 func (t *SQLReport) Disconnect(ctx context.Context) error {
-	if !t.config.IsEnabled {
-		tlog.Debugf("[sqlreport] is disabled, skipping disconnect")
-		return nil
-	}
 	if !t.isConnected {
 		tlog.Debugf("[sqlreport] is already disconnected, skipping disconnect")
 		return nil
 	}
-	t.conn.Close()
-
 	t.cancel()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	err := t.conn.Close()
+	if err != nil {
+		tlog.Warnf("[sqlreport] disconnect failed: %s", err)
+	}
 	t.conn = nil
 	t.isConnected = false
 
@@ -178,7 +193,8 @@ func (t *SQLReport) Send(ctx context.Context, source string, author string, chan
 	return fmt.Errorf("SQL reporting does not support send")
 }
 
-// Subscribe listens for new events on sqlreport
+// Subscribe listens for new events on sqlreport.
+// SQL reporting never emits events, so this is a no-op
 func (t *SQLReport) Subscribe(ctx context.Context, onMessage func(interface{}) error) error {
-	return fmt.Errorf("SQL reporting does not support subscribe")
+	return nil
 }
@@ -0,0 +1,270 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xackery/talkeq/tlog"
+)
+
+// State is the connection state of a supervised endpoint
+type State string
+
+const (
+	// StateConnecting means a connect attempt is in progress
+	StateConnecting State = "connecting"
+	// StateUp means the endpoint is connected
+	StateUp State = "up"
+	// StateBackingOff means the endpoint is down and waiting to retry
+	StateBackingOff State = "backing off"
+	// StateFailed means the endpoint failed too many times in a row, and the circuit is open.
+	// It will only be retried after the circuit cooldown
+	StateFailed State = "failed"
+	// StateDisabled means the endpoint was turned off, and is not reconnected
+	StateDisabled State = "disabled"
+)
+
+// Endpoint is a connection the supervisor keeps alive
+type Endpoint interface {
+	Connect(ctx context.Context) error
+	IsConnected() bool
+}
+
+// Toggler is an Endpoint that can be turned on and off while supervised, such as by a config reload
+type Toggler interface {
+	IsEnabled() bool
+}
+
+// Config is how the supervisor backs off between attempts
+type Config struct {
+	// BaseDelay is the wait after the first failure, doubling on each failure after
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts
+	MaxDelay time.Duration
+	// MaxFailures is how many failures in a row open the circuit, 0 never opens it
+	MaxFailures int
+	// CircuitCooldown is how long an open circuit waits before trying again
+	CircuitCooldown time.Duration
+	// CheckInterval is how often endpoints are checked
+	CheckInterval time.Duration
+}
+
+// Status is a snapshot of a supervised endpoint
+type Status struct {
+	Name        string    `json:"name"`
+	State       State     `json:"state"`
+	Failures    int       `json:"failures"`
+	LastError   string    `json:"last_error,omitempty"`
+	Since       time.Time `json:"since"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+}
+
+// Supervisor watches endpoints and reconnects them when they go down
+type Supervisor struct {
+	mu      sync.RWMutex
+	config  Config
+	entries []*entry
+}
+
+type entry struct {
+	name     string
+	endpoint Endpoint
+	onUp     func()
+	status   Status
+}
+
+// New creates a new supervisor
+func New(config Config) *Supervisor {
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = 10 * time.Second
+	}
+	if config.MaxDelay < config.BaseDelay {
+		config.MaxDelay = config.BaseDelay
+	}
+	if config.CircuitCooldown <= 0 {
+		config.CircuitCooldown = config.MaxDelay
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Second
+	}
+	return &Supervisor{
+		config: config,
+	}
+}
+
+// Watch adds an endpoint to supervise. onUp is called each time the supervisor reconnects it, and can be nil
+func (s *Supervisor) Watch(name string, endpoint Endpoint, onUp func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := &entry{
+		name:     name,
+		endpoint: endpoint,
+		onUp:     onUp,
+		status: Status{
+			Name:  name,
+			State: StateUp,
+			Since: time.Now(),
+		},
+	}
+	if isDisabled(endpoint) {
+		e.status.State = StateDisabled
+	} else if !endpoint.IsConnected() {
+		// the first connect was made before the endpoint was watched, so wait a base delay
+		// before trying again, without counting it towards max failures
+		e.status.State = StateBackingOff
+		e.status.NextAttempt = time.Now().Add(s.delay(1))
+	}
+	s.entries = append(s.entries, e)
+}
+
+// Run supervises every watched endpoint until ctx is done
+func (s *Supervisor) Run(ctx context.Context) {
+	s.mu.RLock()
+	entries := s.entries
+	s.mu.RUnlock()
+
+	wg := sync.WaitGroup{}
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			s.watch(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+	tlog.Debugf("[supervisor] exiting, context done")
+}
+
+// Status returns a snapshot of every supervised endpoint, sorted by name
+func (s *Supervisor) Status() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := []Status{}
+	for _, e := range s.entries {
+		statuses = append(statuses, e.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+func (s *Supervisor) watch(ctx context.Context, e *entry) {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.check(ctx, e)
+	}
+}
+
+func (s *Supervisor) check(ctx context.Context, e *entry) {
+	s.mu.RLock()
+	status := e.status
+	s.mu.RUnlock()
+
+	if isDisabled(e.endpoint) {
+		if status.State != StateDisabled {
+			s.setState(e, StateDisabled, 0, nil)
+		}
+		return
+	}
+
+	if e.endpoint.IsConnected() {
+		if status.State != StateUp {
+			s.setState(e, StateUp, 0, nil)
+		}
+		return
+	}
+
+	if status.State == StateUp {
+		tlog.Warnf("[supervisor] %s connection lost", e.name)
+		s.setState(e, StateBackingOff, 0, nil)
+		status = e.status
+	}
+
+	if time.Now().Before(status.NextAttempt) {
+		return
+	}
+
+	tlog.Infof("[%s] attempting to reconnect", e.name)
+	s.setState(e, StateConnecting, status.Failures, nil)
+	err := e.endpoint.Connect(ctx)
+	if err == nil && e.endpoint.IsConnected() {
+		s.setState(e, StateUp, 0, nil)
+		if e.onUp != nil {
+			e.onUp()
+		}
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("still not connected after connect")
+	}
+	tlog.Warnf("[%s] reconnect failed: %s", e.name, err)
+
+	failures := status.Failures + 1
+	if s.config.MaxFailures > 0 && failures >= s.config.MaxFailures {
+		s.setState(e, StateFailed, failures, err)
+		return
+	}
+	s.setState(e, StateBackingOff, failures, err)
+}
+
+// setState changes an entry's state, and schedules its next attempt
+func (s *Supervisor) setState(e *entry, state State, failures int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.status.State != state {
+		e.status.Since = time.Now()
+		switch state {
+		case StateUp:
+			tlog.Infof("[supervisor] %s is up", e.name)
+		case StateFailed:
+			tlog.Errorf("[supervisor] %s failed %d times in a row, retrying in %s", e.name, failures, s.config.CircuitCooldown)
+		}
+	}
+	e.status.State = state
+	e.status.Failures = failures
+	e.status.LastError = ""
+	if err != nil {
+		e.status.LastError = err.Error()
+	}
+	switch state {
+	case StateBackingOff:
+		e.status.NextAttempt = time.Now().Add(s.delay(failures))
+	case StateFailed:
+		e.status.NextAttempt = time.Now().Add(s.config.CircuitCooldown)
+	case StateUp, StateDisabled:
+		e.status.NextAttempt = time.Time{}
+	}
+}
+
+// isDisabled returns true if endpoint is a Toggler that is turned off
+func isDisabled(endpoint Endpoint) bool {
+	t, ok := endpoint.(Toggler)
+	return ok && !t.IsEnabled()
+}
+
+// delay returns how long to wait after a number of failures in a row, with up to 20% jitter
+func (s *Supervisor) delay(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+	delay := s.config.BaseDelay
+	for i := 1; i < failures && delay < s.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.config.MaxDelay {
+		delay = s.config.MaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay - jitter
+}
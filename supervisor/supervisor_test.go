@@ -0,0 +1,75 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeEndpoint struct {
+	isConnected bool
+	attempts    int
+	failUntil   int
+}
+
+func (e *fakeEndpoint) Connect(ctx context.Context) error {
+	e.attempts++
+	if e.attempts <= e.failUntil {
+		return fmt.Errorf("attempt %d failed", e.attempts)
+	}
+	e.isConnected = true
+	return nil
+}
+
+func (e *fakeEndpoint) IsConnected() bool {
+	return e.isConnected
+}
+
+func TestSupervisor_delay(t *testing.T) {
+	s := New(Config{BaseDelay: 10 * time.Second, MaxDelay: 60 * time.Second})
+	tests := []struct {
+		failures int
+		max      time.Duration
+	}{
+		{failures: 1, max: 10 * time.Second},
+		{failures: 2, max: 20 * time.Second},
+		{failures: 3, max: 40 * time.Second},
+		{failures: 4, max: 60 * time.Second},
+		{failures: 20, max: 60 * time.Second},
+	}
+	for _, tt := range tests {
+		got := s.delay(tt.failures)
+		if got > tt.max || got < tt.max*8/10 {
+			t.Fatalf("delay(%d) = %s, wanted between %s and %s", tt.failures, got, tt.max*8/10, tt.max)
+		}
+	}
+}
+
+func TestSupervisor_check(t *testing.T) {
+	s := New(Config{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxFailures: 2, CircuitCooldown: time.Hour})
+	e := &fakeEndpoint{failUntil: 5}
+	upCount := 0
+	s.Watch("telnet", e, func() { upCount++ })
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(2 * time.Millisecond)
+		s.check(ctx, s.entries[0])
+	}
+	status := s.Status()[0]
+	if status.State != StateFailed {
+		t.Fatalf("wanted state %s, got %s", StateFailed, status.State)
+	}
+	if e.attempts != 2 || status.Failures != 2 {
+		t.Fatalf("wanted 2 attempts and failures before circuit opened, got %d attempts and %d failures", e.attempts, status.Failures)
+	}
+
+	e.failUntil = 0
+	s.entries[0].status.NextAttempt = time.Now()
+	s.check(ctx, s.entries[0])
+	status = s.Status()[0]
+	if status.State != StateUp || upCount != 1 {
+		t.Fatalf("wanted state %s with 1 onUp call, got %s with %d", StateUp, status.State, upCount)
+	}
+}
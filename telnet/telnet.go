@@ -1,7 +1,6 @@
 package telnet
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"regexp"
@@ -12,6 +11,7 @@ import (
 	"github.com/xackery/talkeq/characterdb"
 	"github.com/xackery/talkeq/config"
 	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/router"
 	"github.com/xackery/talkeq/tlog"
 	"github.com/ziutek/telnet"
 )
@@ -35,6 +35,7 @@ type Telnet struct {
 	isPlayerDump   bool
 	lastPlayerDump time.Time
 	characters     map[string]*characterdb.Character
+	db             *characterdb.DB
 	itemLinkCustom *regexp.Regexp
 }
 
@@ -47,6 +48,7 @@ func New(ctx context.Context, config config.Telnet) (*Telnet, error) {
 		cancel:         cancel,
 		isInitialState: true,
 		isNewTelnet:    true,
+		db:             characterdb.New(),
 	}
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -63,18 +65,64 @@ func New(ctx context.Context, config config.Telnet) (*Telnet, error) {
 	if config.Host == "" {
 		config.Host = "127.0.0.1:23"
 	}
-	if config.LinkChunk1Size > 0 && config.LinkChunk2Size > 0 {
-		var err error
-		t.itemLinkCustom, err = regexp.Compile(fmt.Sprintf(`\x12([0-9A-Z]{%d})[0-9A-Z]{%d}([\+0-9A-Za-z-'`+"`"+`:.,!?* ]+)\x12`, config.LinkChunk1Size, config.LinkChunk2Size))
-		if err != nil {
-			return nil, fmt.Errorf("item link custom: %w", err)
-		}
-
+	var err error
+	t.itemLinkCustom, err = itemLinkCustomRegex(config)
+	if err != nil {
+		return nil, fmt.Errorf("item link custom: %w", err)
 	}
 
 	return t, nil
 }
 
+// itemLinkCustomRegex returns a regex for item links with custom chunk sizes, or nil if none are set
+func itemLinkCustomRegex(config config.Telnet) (*regexp.Regexp, error) {
+	if config.LinkChunk1Size < 1 || config.LinkChunk2Size < 1 {
+		return nil, nil
+	}
+	return regexp.Compile(fmt.Sprintf(`\x12([0-9A-Z]{%d})[0-9A-Z]{%d}([\+0-9A-Za-z-'`+"`"+`:.,!?* ]+)\x12`, config.LinkChunk1Size, config.LinkChunk2Size))
+}
+
+// SetConfig swaps in a new configuration, such as routes, without dropping the connection.
+// Returns true if connection settings changed and telnet needs to reconnect for them to apply
+func (t *Telnet) SetConfig(cfg config.Telnet) bool {
+	itemLinkCustom, err := itemLinkCustomRegex(cfg)
+	if err != nil {
+		tlog.Warnf("[telnet] item link custom ignored: %s", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	isReconnect := t.config.IsEnabled != cfg.IsEnabled ||
+		t.config.Host != cfg.Host ||
+		t.config.Username != cfg.Username ||
+		t.config.Password != cfg.Password
+	t.config = cfg
+	t.isNewTelnet = !cfg.IsLegacy
+	t.itemLinkCustom = itemLinkCustom
+	return isReconnect
+}
+
+// Name returns the name of the world telnet is connected to, empty if not set
+func (t *Telnet) Name() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.config.Name
+}
+
+// source returns the name messages from this telnet are relayed from, telnet:<name> for a named world.
+// The caller must hold t.mu
+func (t *Telnet) source() string {
+	if t.config.Name == "" {
+		return "telnet"
+	}
+	return "telnet:" + t.config.Name
+}
+
+// Characters returns the characters online in the world telnet is connected to
+func (t *Telnet) Characters() *characterdb.DB {
+	return t.db
+}
+
 // IsConnected returns if a connection is established
 func (t *Telnet) IsConnected() bool {
 	t.mu.RLock()
@@ -159,69 +207,41 @@ func (t *Telnet) Connect(ctx context.Context) error {
 
 	t.conn.SetReadDeadline(time.Time{})
 	t.conn.SetWriteDeadline(time.Time{})
-	go t.loop(ctx)
+	go t.loop(t.ctx, t.conn)
 	t.isConnected = true
 
 	if !isInitialState && t.config.IsServerAnnounceEnabled && len(t.subscribers) > 0 {
-		for routeIndex, route := range t.config.Routes {
-			if !route.IsEnabled {
-				continue
-			}
-			buf := new(bytes.Buffer)
-			if err := route.MessagePatternTemplate().Execute(buf, struct {
-				Name    string
-				Message string
-			}{
-				"",
-				"",
-			}); err != nil {
-				tlog.Warnf("[telnet] execute %d failed: %s", routeIndex, err)
-				continue
-			}
-
-			if route.Trigger.Custom != "serverup" {
-				continue
-			}
-			req := request.DiscordSend{
-				Ctx:       ctx,
-				ChannelID: route.ChannelID,
-				Message:   buf.String(),
-			}
-			for _, s := range t.subscribers {
-				err = s(req)
-				if err != nil {
-					tlog.Warnf("[telnet->discord subscriber %d] channelID %s message %s failed: %w", route.ChannelID, req.Message, err)
-					continue
-				}
-				tlog.Infof("[telnet->discord] channelID %s message: %s", route.ChannelID, req.Message)
-			}
-		}
-
+		t.relay(ctx, t.source(), router.Custom(t.config.Routes, "serverup"))
 	}
 
 	tlog.Infof("[telnet] connected successfully, listening for messages")
 	return nil
 }
 
-func (t *Telnet) loop(ctx context.Context) {
+// loop reads messages from conn until ctx, the context of the connection it was started for, is done
+func (t *Telnet) loop(ctx context.Context, conn *telnet.Conn) {
 	var data []byte
 	var err error
 	var msg string
 
 	for {
 		select {
-		case <-t.ctx.Done():
+		case <-ctx.Done():
 			tlog.Debugf("[telnet] exiting telnet loop")
 			return
 		default:
 		}
 
-		data, err = t.conn.ReadUntil("\n")
+		data, err = conn.ReadUntil("\n")
 		if err != nil {
 			if strings.Contains(err.Error(), "unknown command:") {
 				tlog.Debugf("[telnet] received unknown command, ignoring: %s", data)
 				continue
 			}
+			if ctx.Err() != nil {
+				tlog.Debugf("[telnet] exiting telnet loop, connection was closed")
+				return
+			}
 			tlog.Warnf("[telnet] read failed: %s", err)
 			t.Disconnect(context.Background())
 			return
@@ -251,58 +271,35 @@ func (t *Telnet) loop(ctx context.Context) {
 // Disconnect stops a previously started connection with Telnet.
 // If called while a connection is not active, returns nil
 func (t *Telnet) Disconnect(ctx context.Context) error {
-	if !t.config.IsEnabled {
-		tlog.Debugf("[telnet] is disabled, skipping disconnect")
-		return nil
-	}
+	t.mu.Lock()
 	if !t.isConnected {
+		t.mu.Unlock()
 		tlog.Debugf("[telnet] already disconnected, skipping disconnect")
 		return nil
 	}
+	// cancel first, so the read loop knows the close is on purpose
+	t.cancel()
 	err := t.conn.Close()
 	if err != nil {
 		tlog.Warnf("[telnet] disconnect failed, ignoring: %s", err)
 	}
-	t.cancel()
 	t.conn = nil
 	t.isConnected = false
-	if !t.isInitialState && t.config.IsServerAnnounceEnabled && len(t.subscribers) > 0 {
-		for routeIndex, route := range t.config.Routes {
-			buf := new(bytes.Buffer)
-			if err := route.MessagePatternTemplate().Execute(buf, struct {
-				Name    string
-				Message string
-			}{
-				"",
-				"",
-			}); err != nil {
-				tlog.Warnf("[telnet] execute route %d failed, skipping: %s", routeIndex, err)
-				continue
-			}
+	isAnnounce := !t.isInitialState && t.config.IsServerAnnounceEnabled && len(t.subscribers) > 0
+	source := t.source()
+	routes := t.config.Routes
+	t.mu.Unlock()
 
-			if route.Trigger.Custom != "serverdown" {
-				continue
-			}
-			req := request.DiscordSend{
-				Ctx:       ctx,
-				ChannelID: route.ChannelID,
-				Message:   buf.String(),
-			}
-			for i, s := range t.subscribers {
-				err = s(req)
-				if err != nil {
-					tlog.Warnf("[telnet->discord subscriber %d] channelID %s message %s failed: %s", i, route.ChannelID, req.Message)
-					continue
-				}
-				tlog.Infof("[telnet->discord subscriber %d] channelID %s message: %s", i, route.ChannelID, req.Message)
-			}
-		}
+	if isAnnounce {
+		t.relay(ctx, source, router.Custom(routes, "serverdown"))
 	}
 	return nil
 }
 
 // Send attempts to send a message through Telnet.
 func (t *Telnet) Send(req request.TelnetSend) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if !t.config.IsEnabled {
 		return fmt.Errorf("telnet is not enabled")
 	}
@@ -326,6 +323,7 @@ func (t *Telnet) Subscribe(ctx context.Context, onMessage func(interface{}) erro
 	return nil
 }
 
+// sendLn writes s as a line. The caller must hold t.mu
 func (t *Telnet) sendLn(s string) (err error) {
 	if t.conn == nil {
 		return fmt.Errorf("no connection created")
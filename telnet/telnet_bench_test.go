@@ -0,0 +1,87 @@
+package telnet
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/xackery/talkeq/config"
+)
+
+// worldChat is a sample of what a busy server's telnet console sees, most of which matches no route
+var worldChat = []string{
+	"Xackery says ooc, 'LFG 55 SK, can tank'",
+	"Shin auctions, 'WTS Fungus Covered Scale Tunic 5k, WTB Jboots'",
+	"Soandso tells the guild [12], 'anyone up for VP tonight?'",
+	"Zone status update: 312 players online",
+	"Rogean general, 'where do I turn in the crushbone belts?'",
+	"Guard Mezzt says, 'Hail, Xackery.'",
+	"Xackery has killed Lord Nagafen in soldungb",
+	"Shin tells you, 'inc'",
+	"Loaded 1240 spawns in zone gfaydark",
+	"Soandso BROADCASTS, 'Server restart in 10 minutes'",
+	"Xackery shouts, 'Train to zone!'",
+	"Character Shin has logged in from 127.0.0.1",
+}
+
+// benchmarkRoutes is a busy server's routes, one per chat channel plus a few announcements
+func benchmarkRoutes() []config.Route {
+	regexes := []string{
+		`(\w+) says ooc, '(.*)'`,
+		`(\w+) auctions, '(.*)'`,
+		`(\w+) general, '(.*)'`,
+		`(\w+) BROADCASTS, '(.*)'`,
+		`(\w+) shouts, '(.*)'`,
+		`(\w+) tells the guild \[([0-9]+)\], '(.*)'`,
+		`(\w+) has killed ([\w ]+) in (\w+)`,
+		`(\w+) has reached level ([0-9]+)`,
+		`(\w+) has completed the ([\w ]+) quest`,
+		`(\w+) says lfg, '(.*)'`,
+		`(\w+) says raid, '(.*)'`,
+		`(\w+) says trade, '(.*)'`,
+	}
+	routes := []config.Route{}
+	for i, regex := range regexes {
+		routes = append(routes, config.Route{
+			IsEnabled:      true,
+			Trigger:        config.Trigger{Regex: regex, NameIndex: 1, MessageIndex: 2},
+			Target:         "discord",
+			ChannelID:      fmt.Sprintf("%d", i+1),
+			MessagePattern: "{{.Name}}: {{.Message}}",
+		})
+	}
+	return routes
+}
+
+func benchmarkReplay(b *testing.B, isLoaded bool) {
+	cfg := config.Telnet{
+		IsEnabled: true,
+		Routes:    benchmarkRoutes(),
+	}
+	if isLoaded {
+		err := cfg.Verify()
+		if err != nil {
+			b.Fatalf("verify: %s", err)
+		}
+	}
+	t, err := New(context.Background(), cfg)
+	if err != nil {
+		b.Fatalf("new: %s", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.Replay(worldChat[i%len(worldChat)])
+	}
+}
+
+// BenchmarkReplay compares routes loaded by Verify against routes that never were.
+// Match gets a copy of each route, so unloaded routes compile their regex for every line,
+// the same as before regexes were compiled once at Verify
+func BenchmarkReplay(b *testing.B) {
+	b.Run("precompiled", func(b *testing.B) {
+		benchmarkReplay(b, true)
+	})
+	b.Run("compiled per line", func(b *testing.B) {
+		benchmarkReplay(b, false)
+	})
+}
@@ -1,15 +1,15 @@
 package telnet
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/xackery/talkeq/guilddb"
-	"github.com/xackery/talkeq/request"
+	"github.com/xackery/talkeq/auction"
+	"github.com/xackery/talkeq/ratelimit"
+	"github.com/xackery/talkeq/router"
 	"github.com/xackery/talkeq/tlog"
 )
 
@@ -20,10 +20,18 @@ var (
 	itemLink50 = regexp.MustCompile(`\x12([0-9A-Z]{6})[0-9A-Z]{50}([\+()0-9A-Za-z-'` + "`" + `:.,!?* ]+)\x12`)
 	// custom secrets itemlinks (64bit) are 9, then 71 bytes
 	itemLink71 = regexp.MustCompile(`\x12([0-9A-Z]{9})[0-9A-Z]{68}([\+()0-9A-Za-z-'` + "`" + `:.,!?* ]+)\x12`)
+	// oocRegex matches ooc chat, which is relayed as an auction if convert_ooc_auction is set
+	oocRegex = regexp.MustCompile(`(\w+) says ooc, '(.*)'`)
 )
 
 func (t *Telnet) convertLinks(message string) string {
+	out, _ := t.linkItems(message, nil)
+	return out
+}
 
+// linkItems converts the item links in message like convertLinks, and returns the names of items
+// it could only show as *Item Name*, appended to items, so they aren't escaped for discord
+func (t *Telnet) linkItems(message string, items []string) (string, []string) {
 	matches := itemLink71.FindAllStringSubmatchIndex(message, -1)
 	if len(matches) == 0 {
 		matches = itemLink50.FindAllStringSubmatchIndex(message, -1)
@@ -61,6 +69,7 @@ func (t *Telnet) convertLinks(message string) string {
 
 			} else {
 				out += fmt.Sprintf("*%s* ", itemName)
+				items = append(items, itemName)
 			}
 		} else {
 			if t.config.IsLinksEmbedded {
@@ -71,94 +80,84 @@ func (t *Telnet) convertLinks(message string) string {
 		}
 		out += message[submatches[1]:]
 		out = strings.TrimSpace(out)
-		out = t.convertLinks(out)
-		break
+		return t.linkItems(out, items)
 	}
-	return out
+	return out, items
 }
 
-func (t *Telnet) parseMessage(msg string) bool {
-	msg = t.convertLinks(msg)
+// Replay matches msg against routes the same way as a message received over telnet, without relaying it.
+// Results are from this telnet's endpoint, e.g. telnet:<name> for a named world
+func (t *Telnet) Replay(msg string) []router.Result {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	msg, items := t.linkItems(msg, nil)
 	msg = strings.ReplaceAll(msg, "&PCT;", `%`)
-
-	for routeIndex, route := range t.config.Routes {
-		if route.Trigger.Custom != "" {
-			continue
+	if t.config.IsOOCAuctionEnabled {
+		var isAuction bool
+		msg, isAuction = auction.Convert(msg, oocRegex, "%s auctions, '%s'")
+		if isAuction {
+			tlog.Debugf("[telnet] ooc message is an auction, relaying as one: %s", msg)
 		}
-		pattern, err := regexp.Compile(route.Trigger.Regex)
+	}
 
-		if err != nil {
-			tlog.Debugf("[telnet] compile route %d failed: %s", routeIndex, err)
-			continue
-		}
-		matches := pattern.FindAllStringSubmatch(msg, -1)
-		if len(matches) == 0 {
-			continue
-		}
+	return router.Match(t.config.Routes, msg, router.Options{
+		Source: t.source(),
+		FormatName: func(name string) string {
+			if t.config.ProfileURL == "" {
+				return name
+			}
+			return fmt.Sprintf("[%s](<%s%s>)", name, t.config.ProfileURL, name)
+		},
+		ItemURL:    t.config.ItemURL,
+		ProfileURL: t.config.ProfileURL,
+		ItemNames:  items,
+	})
+}
+
+func (t *Telnet) parseMessage(msg string) bool {
+	t.mu.RLock()
+	source := t.source()
+	t.mu.RUnlock()
+	t.relay(context.Background(), source, t.Replay(msg))
+	return true
+}
 
-		name := ""
-		message := ""
-		if route.Trigger.MessageIndex > len(matches[0]) {
-			tlog.Warnf("[telnet] route %d trigger message_index %d greater than matches %d", routeIndex, route.Trigger.MessageIndex, len(matches[0]))
+// relay sends each routed result to its target
+func (t *Telnet) relay(ctx context.Context, source string, results []router.Result) {
+	for _, result := range results {
+		if result.Err != nil {
+			tlog.Warnf("[telnet] route %d skipped: %s", result.Index, result.Err)
 			continue
 		}
-		message = matches[0][route.Trigger.MessageIndex]
-		if route.Trigger.NameIndex > len(matches[0]) {
-			tlog.Warnf("[telnet route %d name_index %d greater than matches %d", routeIndex, route.Trigger.MessageIndex, len(matches[0]))
+		if result.Filtered != nil {
 			continue
 		}
-		name = matches[0][route.Trigger.NameIndex]
-		if route.Trigger.GuildIndex > 0 && route.Trigger.GuildIndex <= len(matches[0]) {
-			route.GuildID = matches[0][route.Trigger.GuildIndex]
-			iGuildID, err := strconv.Atoi(route.GuildID)
-			if err != nil {
-				tlog.Warnf("[telnet] route %d guild_index %s is not an integer matches %d", routeIndex, route.GuildID, len(matches[0]))
-				continue
-			}
-			tmpChannelID := guilddb.ChannelID(int(iGuildID))
-			if tmpChannelID == "" {
-				if route.ChannelID == "INSERTGLOBALGUILDCHANNELHERE" {
-					continue //in cases a guild route happened and default settings, no need to attempt the route
-				}
-				tlog.Debugf("[telnet] route %d guild_index %d is not in talkeq_guilds, falling back to discord channel %s", routeIndex, iGuildID, route.ChannelID)
-			} else {
-				route.ChannelID = tmpChannelID
-			}
-		}
-
-		buf := new(bytes.Buffer)
-		if t.config.ProfileURL != "" {
-			name = fmt.Sprintf("[%s](<%s%s>)", name, t.config.ProfileURL, name)
-		}
-		if err := route.MessagePatternTemplate().Execute(buf, struct {
-			Name    string
-			Message string
-		}{
-			name,
-			message,
-		}); err != nil {
-			tlog.Warnf("[telnet] route %d execute: %s", routeIndex, err)
+		route := result.Route
+		req, err := result.Request(ctx, source)
+		if err != nil {
+			tlog.Warnf("[telnet] route %d skipped: %s", result.Index, err)
 			continue
 		}
-		switch route.Target {
-		case "discord":
-			req := request.DiscordSend{
-				Ctx:       context.Background(),
-				ChannelID: route.ChannelID,
-				Message:   buf.String(),
-			}
-			for i, s := range t.subscribers {
-				err = s(req)
+		// send runs later if the rate limit queues it
+		result := result
+		subscribers := t.subscribers
+		send := func() {
+			for i, s := range subscribers {
+				err := s(req)
 				if err != nil {
-					tlog.Warnf("[telnet->discord subscriber %d] channelID %s message %s failed: %s", i, route.ChannelID, req.Message, err)
+					tlog.Warnf("[%s->%s subscriber %d] channelID %s message %s failed: %s", source, route.Target, i, route.ChannelID, result.Text, err)
 					continue
 				}
-				tlog.Infof("[telnet->discord subscribe %d] channelID %s message: %s", i, route.ChannelID, req.Message)
+				tlog.Infof("[%s->%s subscriber %d] channelID %s message: %s", source, route.Target, i, route.ChannelID, result.Text)
 			}
-		default:
-			tlog.Warnf("[telnet] unsupported target type: %s", route.Target)
+		}
+		wait, err := ratelimit.Do(route.RateLimitKey(source), result.Name, result.Text, route.RateLimit, send)
+		if err != nil {
+			tlog.Infof("[telnet] route %d limited: %s", result.Index, err)
 			continue
 		}
+		if wait > 0 {
+			tlog.Debugf("[telnet] route %d queued for %s", result.Index, wait)
+		}
 	}
-	return true
 }
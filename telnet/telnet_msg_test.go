@@ -153,3 +153,177 @@ func TestTelnet_parseMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestTelnet_ReplayAuction(t *testing.T) {
+	cfg := config.Telnet{
+		IsEnabled:           true,
+		IsOOCAuctionEnabled: true,
+		ItemURL:             "http://test.com?itemid=",
+		Routes: []config.Route{
+			{
+				IsEnabled:      true,
+				Trigger:        config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+				Target:         "discord",
+				ChannelID:      "ooc",
+				MessagePattern: "{{.Name}} **OOC**: {{.Message}}",
+			},
+			{
+				IsEnabled:      true,
+				Trigger:        config.Trigger{Regex: `(\w+) auctions, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+				Target:         "discord",
+				ChannelID:      "auction",
+				MessagePattern: "{{.Name}} **auction**:{{range .Offers}} {{.}}{{end}}",
+			},
+		},
+	}
+	err := cfg.Verify()
+	if err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	client, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	results := client.Replay("Shin says ooc, 'WTS \x1200046F00000000000000000000000000000000000000000014D2720CMask of Tinkering\x12 5k'")
+	if len(results) != 1 || results[0].Route.ChannelID != "auction" {
+		t.Fatalf("expected the ooc auction on the auction route: %+v", results)
+	}
+	want := "Shin **auction**: WTS: [Mask of Tinkering](<http://test.com?itemid=1135>) (5k)"
+	if results[0].Text != want {
+		t.Fatalf("got %q, want %q", results[0].Text, want)
+	}
+
+	results = client.Replay("Shin says ooc, 'hello'")
+	if len(results) != 1 || results[0].Route.ChannelID != "ooc" {
+		t.Fatalf("expected a plain ooc message on the ooc route: %+v", results)
+	}
+}
+
+func TestTelnet_ReplayEscape(t *testing.T) {
+	cfg := config.Telnet{
+		IsEnabled:  true,
+		ItemURL:    "http://test.com?itemid=",
+		ProfileURL: "http://test.com?char=",
+		Routes: []config.Route{
+			{
+				IsEnabled:      true,
+				Trigger:        config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+				Target:         "discord",
+				ChannelID:      "ooc",
+				MessagePattern: "{{.Name}} **OOC**: {{.Message}}",
+			},
+			{
+				IsEnabled:         true,
+				Trigger:           config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+				Target:            "discord",
+				ChannelID:         "code",
+				MessagePattern:    "```{{.Message}}```",
+				IsMarkdownAllowed: true,
+			},
+			{
+				IsEnabled:      true,
+				Trigger:        config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+				Target:         "telnet",
+				ChannelID:      "260",
+				MessagePattern: "{{.Name}}: {{.Message}}",
+			},
+		},
+	}
+	err := cfg.Verify()
+	if err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	client, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	results := client.Replay("Shin says ooc, '**buy** \x1200046F00000000000000000000000000000000000000000014D2720CMask of Tinkering\x12 ||@everyone|| [free](<http://evil.com>)'")
+	if len(results) != 3 {
+		t.Fatalf("got %d results, wanted 3: %+v", len(results), results)
+	}
+	want := `[Shin](<http://test.com?char=Shin>) **OOC**: \*\*buy\*\* [Mask of Tinkering](<http://test.com?itemid=1135>) \|\|\@everyone\|\| \[free\](\<http://evil.com\>)`
+	if results[0].Text != want {
+		t.Fatalf("discord got %q, want %q", results[0].Text, want)
+	}
+	want = "```**buy** [Mask of Tinkering](<http://test.com?itemid=1135>) ||@everyone|| [free](<http://evil.com>)```"
+	if results[1].Text != want {
+		t.Fatalf("allow_markdown got %q, want %q", results[1].Text, want)
+	}
+	want = "[Shin](<http://test.com?char=Shin>): **buy** [Mask of Tinkering](<http://test.com?itemid=1135>) ||@everyone|| [free](<http://evil.com>)"
+	if results[2].Text != want {
+		t.Fatalf("telnet got %q, want %q", results[2].Text, want)
+	}
+}
+
+func TestTelnet_ReplaySource(t *testing.T) {
+	for name, want := range map[string]string{"": "telnet", "live": "telnet:live"} {
+		cfg := config.Telnet{
+			IsEnabled: true,
+			Name:      name,
+			Routes: []config.Route{
+				{
+					IsEnabled:      true,
+					Trigger:        config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+					Target:         "discord",
+					ChannelID:      "ooc",
+					MessagePattern: "{{.Name}}: {{.Message}}",
+				},
+			},
+		}
+		err := cfg.Verify()
+		if err != nil {
+			t.Fatalf("verify: %s", err)
+		}
+		client, err := New(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("new: %s", err)
+		}
+		results := client.Replay("Shin says ooc, 'hello'")
+		if len(results) != 1 || results[0].Source != want {
+			t.Fatalf("name %q got %+v, want source %s", name, results, want)
+		}
+	}
+}
+
+func TestTelnet_ReplayLegacyLinks(t *testing.T) {
+	cfg := config.Telnet{
+		IsEnabled:     true,
+		IsLegacyLinks: true,
+		Routes: []config.Route{
+			{
+				IsEnabled:      true,
+				Trigger:        config.Trigger{Regex: `(\w+) says ooc, '(.*)'`, NameIndex: 1, MessageIndex: 2},
+				Target:         "discord",
+				ChannelID:      "ooc",
+				MessagePattern: "{{.Name}}: {{.Message}} |{{range .Offers}} {{.}}{{end}}",
+			},
+		},
+	}
+	err := cfg.Verify()
+	if err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	client, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"Shin says ooc, 'WTS \x120112A4000000000000000000000000000000000000000000244AE3C6Frosted Gem of Ferocity\x12 5k'", `Shin: WTS *Frosted Gem of Ferocity*  5k | WTS: *Frosted Gem of Ferocity* (5k)`},
+		{"Shin says ooc, 'not an *item*'", `Shin: not an \*item\* |`},
+	}
+	for _, tt := range tests {
+		results := client.Replay(tt.line)
+		if len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("unexpected results: %+v", results)
+		}
+		if results[0].Text != tt.want {
+			t.Fatalf("got %q, want %q", results[0].Text, tt.want)
+		}
+	}
+}
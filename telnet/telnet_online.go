@@ -15,12 +15,14 @@ import (
 var (
 	playersOnlineRegex = regexp.MustCompile("([0-9]+) players online")
 	playerEntryRegex   = regexp.MustCompile(`(.*) \[([a-zA-Z]+)? ?([0-9]+) (.*)\] (.*) \((.*)\) .* zone\: (.*) AccID: (.*) AccName: (.*) LSID: (.*) Status: (.*)`)
+	// playerGuildRegex finds the guild a who entry lists after the race, e.g. (Dark Elf) <Guild Name> zone:
+	playerGuildRegex = regexp.MustCompile(`\) <([^>]+)> .*zone\: `)
 )
 
 func (t *Telnet) parsePlayerEntries(msg string) bool {
 	var err error
 	if t.isPlayerDump && time.Now().After(t.lastPlayerDump) {
-		err = characterdb.SetCharacters(t.characters)
+		err = t.db.SetCharacters(t.characters)
 		if err != nil {
 			tlog.Warnf("[telnet] setcharacters failed: %s", err)
 			return true
@@ -39,7 +41,7 @@ func (t *Telnet) parsePlayerEntries(msg string) bool {
 	}
 
 	if t.isPlayerDump && strings.Contains(msg, "players online") {
-		err = characterdb.SetCharacters(t.characters)
+		err = t.db.SetCharacters(t.characters)
 		if err != nil {
 			tlog.Warnf("[telnet] setcharacters playersOnline failed: %s", err)
 			return true
@@ -81,6 +83,12 @@ func (t *Telnet) parsePlayerEntries(msg string) bool {
 			tlog.Debugf("[telnet] failed to parse %s status (%s): %s", msg, submatches[11], err)
 			status = 0
 		}
+
+		guild := ""
+		guildMatch := playerGuildRegex.FindStringSubmatch(submatches[0])
+		if len(guildMatch) > 1 {
+			guild = guildMatch[1]
+		}
 		t.characters[submatches[5]] = &characterdb.Character{
 			IsOnline: true,
 			Identity: submatches[1],
@@ -90,6 +98,7 @@ func (t *Telnet) parsePlayerEntries(msg string) bool {
 			Name:     submatches[5],
 			Race:     submatches[6],
 			Zone:     submatches[7],
+			Guild:    guild,
 			AcctID:   acctID,
 			AcctName: submatches[9],
 			LSID:     lsID,
@@ -118,20 +127,19 @@ func (t *Telnet) parsePlayersOnline(msg string) bool {
 		return false
 	}
 
-	characterdb.SetCharactersOnlineCount(online)
+	t.db.SetCharactersOnlineCount(online)
 
 	return true
 }
 
 // Who returns number of online players
 func (t *Telnet) Who(ctx context.Context) (int, error) {
+	t.mu.RLock()
 	err := t.sendLn("who")
+	t.mu.RUnlock()
 	if err != nil {
 		return 0, fmt.Errorf("who request: %w", err)
 	}
 	time.Sleep(100 * time.Millisecond)
-	t.mu.RLock()
-	online := characterdb.CharactersOnlineCount()
-	t.mu.RUnlock()
-	return online, nil
+	return t.db.CharactersOnlineCount(), nil
 }
@@ -163,3 +163,26 @@ func TestTelnet_Who(t *testing.T) {
 		})
 	}
 }
+
+func TestTelnet_parsePlayerEntriesGuild(t *testing.T) {
+	tr := &Telnet{
+		isPlayerDump:   true,
+		lastPlayerDump: time.Now().Add(time.Minute),
+		characters:     make(map[string]*characterdb.Character),
+	}
+	msg := "  [60 Shadow Knight] Xackery (Dark Elf) <Dark Harvest> zone: soldungb AccID: 1 AccName: xack LSID: 2 Status: 0\n" +
+		"  [52 Monk] Shin (Human)  zone: gfaydark AccID: 3 AccName: shin LSID: 4 Status: 0"
+	if !tr.parsePlayerEntries(msg) {
+		t.Fatalf("parsePlayerEntries() = false, want true")
+	}
+	tests := map[string]string{"Xackery": "Dark Harvest", "Shin": ""}
+	for name, guild := range tests {
+		c, ok := tr.characters[name]
+		if !ok {
+			t.Fatalf("%s was not parsed", name)
+		}
+		if c.Guild != guild {
+			t.Fatalf("%s guild = %q, want %q", name, c.Guild, guild)
+		}
+	}
+}
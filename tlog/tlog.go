@@ -5,12 +5,15 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 var (
+	// initMu guards Init, since the first log line may come from several goroutines at once
+	initMu       sync.Mutex
 	isInitialied bool
 	// Sugar represents a zap logger
 	Sugar *zap.SugaredLogger
@@ -20,6 +23,8 @@ var (
 
 // Init creates and initializes the logging
 func Init(fileWriter io.Writer, consoleWriter io.Writer) {
+	initMu.Lock()
+	defer initMu.Unlock()
 	if isInitialied {
 		return
 	}
@@ -0,0 +1,192 @@
+package tmplfunc
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xackery/talkeq/characterdb"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+var (
+	mu     sync.RWMutex
+	worlds []*characterdb.DB
+	// profileLinkRegex matches a name telnet rewrote into a profile link, e.g. [Xackery](<https://example.com/Xackery>)
+	profileLinkRegex = regexp.MustCompile(`^\[([^\]]+)\]\(.*\)$`)
+	// markdownReplacer escapes characters discord treats as markdown, masked links, headings and mentions
+	markdownReplacer = strings.NewReplacer(
+		`\`, `\\`,
+		"*", `\*`,
+		"_", `\_`,
+		"~", `\~`,
+		"`", "\\`",
+		"|", `\|`,
+		">", `\>`,
+		"<", `\<`,
+		"[", `\[`,
+		"]", `\]`,
+		"#", `\#`,
+		"@", `\@`,
+	)
+	// linkRegexes caches the regex EscapeMarkdownLinks builds for each set of link prefixes
+	linkRegexes sync.Map
+)
+
+// New returns a template named name, with every function in FuncMap registered.
+// Every pattern in the configuration should be parsed with it
+func New(name string) *template.Template {
+	return template.New(name).Funcs(FuncMap())
+}
+
+// FuncMap returns the functions available to patterns, e.g. {{.Message | truncate 100}}
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"truncate":       Truncate,
+		"upper":          strings.ToUpper,
+		"lower":          strings.ToLower,
+		"title":          Title,
+		"escapeMarkdown": EscapeMarkdown,
+		"now":            time.Now,
+		"date":           Date,
+		"pluralize":      Pluralize,
+		"charLevel":      CharLevel,
+		"charClass":      CharClass,
+		"charZone":       CharZone,
+	}
+}
+
+// AddCharacters adds a world's characters to lookups such as charLevel.
+// When a name is online in more than one world, the first added wins
+func AddCharacters(db *characterdb.DB) {
+	mu.Lock()
+	defer mu.Unlock()
+	worlds = append(worlds, db)
+}
+
+// Truncate shortens s to at most length characters, ending it with ... if it was cut
+func Truncate(length int, s string) string {
+	if length < 1 || utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	runes := []rune(s)
+	if length <= 3 {
+		return string(runes[:length])
+	}
+	return string(runes[:length-3]) + "..."
+}
+
+// Title capitalizes the first letter of each word in s
+func Title(s string) string {
+	return cases.Title(language.AmericanEnglish).String(s)
+}
+
+// EscapeMarkdown escapes s so discord shows it as typed, instead of as formatting
+func EscapeMarkdown(s string) string {
+	return markdownReplacer.Replace(s)
+}
+
+// EscapeMarkdownLinks escapes s like EscapeMarkdown, but keeps links to urls that start with one of linkPrefixes,
+// e.g. item links telnet made, as [Jboots](<https://...>), <https://...> (Jboots) or https://... (Jboots).
+// The text of a kept masked link is still escaped
+func EscapeMarkdownLinks(s string, linkPrefixes ...string) string {
+	pattern := linkRegex(linkPrefixes)
+	if pattern == nil {
+		return EscapeMarkdown(s)
+	}
+	out := ""
+	last := 0
+	for _, link := range pattern.FindAllStringSubmatchIndex(s, -1) {
+		out += EscapeMarkdown(s[last:link[0]])
+		if link[2] >= 0 {
+			// masked link, [text](<url>)
+			out += "[" + EscapeMarkdown(s[link[2]:link[3]]) + "]" + s[link[3]+1:link[1]]
+		} else {
+			out += s[link[0]:link[1]]
+		}
+		last = link[1]
+	}
+	return out + EscapeMarkdown(s[last:])
+}
+
+// linkRegex returns a regex matching masked and bare links to any of linkPrefixes, or nil if there are none
+func linkRegex(linkPrefixes []string) *regexp.Regexp {
+	prefixes := []string{}
+	for _, prefix := range linkPrefixes {
+		if prefix == "" {
+			continue
+		}
+		prefixes = append(prefixes, regexp.QuoteMeta(prefix))
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	key := strings.Join(prefixes, "|")
+	cached, ok := linkRegexes.Load(key)
+	if ok {
+		return cached.(*regexp.Regexp)
+	}
+	pattern := regexp.MustCompile(`\[([^\]]*)\]\(<?(?:` + key + `)[^\s<>()]*>?\)|<(?:` + key + `)[^\s<>]*>|(?:` + key + `)[^\s<>()]*`)
+	linkRegexes.Store(key, pattern)
+	return pattern
+}
+
+// Date formats t with a go layout, e.g. "15:04 MST", in the IANA time zone zone, e.g. America/Chicago.
+// An empty or unknown zone uses the local time zone
+func Date(layout string, zone string, t time.Time) string {
+	if zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err == nil {
+			t = t.In(location)
+		}
+	}
+	return t.Format(layout)
+}
+
+// Pluralize returns singular if count is 1, otherwise plural
+func Pluralize(count int, singular string, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
+
+// CharLevel returns the level of an online character, or 0 if they are not online
+func CharLevel(name string) int {
+	c, _ := character(name)
+	return c.Level
+}
+
+// CharClass returns the class of an online character, or an empty string if they are not online
+func CharClass(name string) string {
+	c, _ := character(name)
+	return c.Class
+}
+
+// CharZone returns the zone of an online character, or an empty string if they are not online
+func CharZone(name string) string {
+	c, _ := character(name)
+	return c.Zone
+}
+
+// character looks up an online character in every world
+func character(name string) (characterdb.Character, bool) {
+	// .Name can be a profile link if telnet's profile_url is set
+	matches := profileLinkRegex.FindStringSubmatch(name)
+	if len(matches) > 1 {
+		name = matches[1]
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, db := range worlds {
+		c, ok := db.Character(name)
+		if ok {
+			return c, true
+		}
+	}
+	return characterdb.Character{}, false
+}
@@ -0,0 +1,70 @@
+package tmplfunc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/xackery/talkeq/characterdb"
+)
+
+func TestEscapeMarkdownLinks(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"**hi** <@123>", `\*\*hi\*\* \<\@123\>`},
+		{"WTS [Jboots](<https://item.com?id=1>) 5k", "WTS [Jboots](<https://item.com?id=1>) 5k"},
+		{"[*Jboots*](https://item.com?id=1_2)", `[\*Jboots\*](https://item.com?id=1_2)`},
+		{"<https://item.com?id=1_2> (Jboots)", "<https://item.com?id=1_2> (Jboots)"},
+		{"https://item.com?id=1_2 (Jboots) # sale", `https://item.com?id=1_2 (Jboots) \# sale`},
+		{"[free](<https://evil.com>)", `\[free\](\<https://evil.com\>)`},
+	}
+	for _, tt := range tests {
+		got := EscapeMarkdownLinks(tt.input, "", "https://item.com?id=")
+		if got != tt.want {
+			t.Fatalf("EscapeMarkdownLinks(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	db := characterdb.New()
+	db.SetCharacters(map[string]*characterdb.Character{
+		"Xackery": {Name: "Xackery", Level: 60, Class: "Shadow Knight", Zone: "soldungb"},
+	})
+	AddCharacters(db)
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{`{{.Message | truncate 8}}`, "Hello..."},
+		{`{{upper .Name}} {{lower .Name}} {{title "lord nagafen"}}`, "XACKERY xackery Lord Nagafen"},
+		{`{{escapeMarkdown "*bold* _it_"}}`, `\*bold\* \_it\_`},
+		{`{{.Count}} {{pluralize .Count "player" "players"}}`, "2 players"},
+		{`{{charLevel .Name}} {{charClass .Name}} {{charZone .Name}}`, "60 Shadow Knight soldungb"},
+		{`{{charLevel "[Xackery](<https://example.com/Xackery>)"}}`, "60"},
+		{`{{charLevel "Nobody"}}{{charZone "Nobody"}}`, "0"},
+		{`{{now | date "2006" "America/Chicago" | len}}`, "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			tmpl, err := New("root").Parse(tt.pattern)
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			buf := new(bytes.Buffer)
+			err = tmpl.Execute(buf, struct {
+				Name    string
+				Message string
+				Count   int
+			}{"Xackery", "Hello, Norrath", 2})
+			if err != nil {
+				t.Fatalf("execute: %s", err)
+			}
+			if buf.String() != tt.want {
+				t.Fatalf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package userdb
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -24,6 +26,8 @@ var (
 type UserEntry struct {
 	CharacterName string
 	DiscordID     string
+	// IsDMEnabled is set if the user opted in to tells to their character as discord DMs, dm at the end of a txt line
+	IsDMEnabled bool
 }
 
 // New initializes and creates the user database
@@ -138,20 +142,21 @@ func reload() error {
 			if line == "" || strings.HasPrefix(line, "#") {
 				continue
 			}
+			if strings.Contains(line, "#") {
+				line = strings.TrimSpace(line[:strings.Index(line, "#")])
+			}
 			parts := strings.Split(line, ":")
-			if len(parts) != 2 {
+			if len(parts) != 2 && len(parts) != 3 {
 				continue
 			}
 
 			discordID := strings.TrimSpace(parts[0])
 			characterName := strings.TrimSpace(parts[1])
-			if strings.Contains(characterName, "#") {
-				characterName = strings.TrimSpace(characterName[:strings.Index(characterName, "#")])
-			}
 
 			ue[discordID] = UserEntry{
 				DiscordID:     discordID,
 				CharacterName: characterName,
+				IsDMEnabled:   len(parts) == 3 && strings.TrimSpace(parts[2]) == "dm",
 			}
 		}
 	}
@@ -163,23 +168,55 @@ func reload() error {
 // Set updates or adds an entry for a specified user id
 func Set(discordID string, characterName string) {
 	mu.Lock()
+	defer mu.Unlock()
+	if users == nil {
+		users = make(map[string]UserEntry)
+	}
 
-	ue, ok := users[discordID]
-	if ok {
-		ue.CharacterName = characterName
-		ue.DiscordID = discordID
-		return
+	ue := users[discordID]
+	ue.DiscordID = discordID
+	ue.CharacterName = characterName
+	users[discordID] = ue
+	err := save()
+	if err != nil {
+		tlog.Warnf("[userdb] save failed: %s", err)
 	}
+}
 
-	ue = UserEntry{
-		DiscordID:     discordID,
-		CharacterName: characterName,
+// SetDMEnabled opts a registered user in or out of tells to their character as discord DMs
+func SetDMEnabled(discordID string, isEnabled bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+	ue, ok := users[discordID]
+	if !ok {
+		return fmt.Errorf("%s is not registered", discordID)
 	}
+	ue.IsDMEnabled = isEnabled
 	users[discordID] = ue
 	err := save()
 	if err != nil {
-		tlog.Warnf("[userdb] save failed: %s", err)
+		return fmt.Errorf("save: %w", err)
 	}
+	return nil
+}
+
+// IsDMEnabled returns true if a user opted in to tells to their character as discord DMs
+func IsDMEnabled(discordID string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return users[discordID].IsDMEnabled
+}
+
+// DiscordID returns the ID of the user registered to a character, ignoring case, or an empty string if there is none
+func DiscordID(characterName string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, ue := range users {
+		if strings.EqualFold(ue.CharacterName, characterName) {
+			return ue.DiscordID
+		}
+	}
+	return ""
 }
 
 // Name returns the name of a user based on their ID
@@ -194,16 +231,94 @@ func Name(discordID string) string {
 	return name
 }
 
+// save writes users to the database through a temporary file, so a crash can't leave it half written.
+// A txt database keeps its comments and the order of its lines, and new users are added at the end
 func save() error {
-	f, err := os.Create(usersDatabasePath)
+	buf := new(bytes.Buffer)
+	if filepath.Ext(usersDatabasePath) == ".toml" {
+		enc := toml.NewEncoder(buf)
+		err := enc.Encode(users)
+		if err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+	} else {
+		data, err := os.ReadFile(usersDatabasePath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("readFile: %w", err)
+		}
+		buf.WriteString(updateLines(string(data), users))
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(usersDatabasePath), filepath.Base(usersDatabasePath)+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("create: %w", err)
+		return fmt.Errorf("createTemp: %w", err)
 	}
-	defer f.Close()
-	enc := toml.NewEncoder(f)
-	err = enc.Encode(users)
+	defer os.Remove(f.Name())
+	_, err = f.Write(buf.Bytes())
 	if err != nil {
-		return fmt.Errorf("encode: %w", err)
+		f.Close()
+		return fmt.Errorf("write: %w", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	err = os.Rename(f.Name(), usersDatabasePath)
+	if err != nil {
+		return fmt.Errorf("rename: %w", err)
 	}
 	return nil
 }
+
+// updateLines rewrites the lines of a txt database to match entries, keeping comments,
+// and appends entries it doesn't have yet
+func updateLines(data string, entries map[string]UserEntry) string {
+	written := map[string]bool{}
+	lines := []string{}
+	if strings.TrimSpace(data) == "" {
+		lines = append(lines, "#userid:username, and :dm to get tells as discord DMs")
+	} else {
+		lines = strings.Split(strings.TrimRight(data, "\n"), "\n")
+	}
+	for i, line := range lines {
+		entry, comment := line, ""
+		if index := strings.Index(line, "#"); index >= 0 {
+			entry, comment = line[:index], line[index:]
+		}
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 2 && len(parts) != 3 {
+			continue
+		}
+		id := strings.TrimSpace(parts[0])
+		ue, ok := entries[id]
+		if !ok {
+			continue
+		}
+		lines[i] = userLine(ue)
+		if comment != "" {
+			lines[i] += " " + comment
+		}
+		written[id] = true
+	}
+
+	ids := []string{}
+	for id := range entries {
+		if !written[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		lines = append(lines, userLine(entries[id]))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// userLine returns a user's txt database line, e.g. 87784167131066368:Xackery:dm
+func userLine(ue UserEntry) string {
+	line := fmt.Sprintf("%s:%s", ue.DiscordID, ue.CharacterName)
+	if ue.IsDMEnabled {
+		line += ":dm"
+	}
+	return line
+}
@@ -2,6 +2,8 @@ package userdb
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -27,3 +29,71 @@ func Test_reload(t *testing.T) {
 		})
 	}
 }
+
+// useDatabase points the package at path for the rest of a test
+func useDatabase(t *testing.T, path string) {
+	mu.Lock()
+	oldUsers, oldPath := users, usersDatabasePath
+	users, usersDatabasePath = nil, path
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		users, usersDatabasePath = oldUsers, oldPath
+		mu.Unlock()
+	})
+}
+
+func TestSetDMEnabled(t *testing.T) {
+	useDatabase(t, filepath.Join(t.TempDir(), "users.txt"))
+
+	Set("87784167131066368", "Xackery")
+	err := SetDMEnabled("87784167131066368", true)
+	if err != nil {
+		t.Fatalf("setDMEnabled: %s", err)
+	}
+	err = SetDMEnabled("1", true)
+	if err == nil {
+		t.Fatalf("expected an unregistered user to fail")
+	}
+
+	err = reload()
+	if err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+	if DiscordID("xackery") != "87784167131066368" || !IsDMEnabled("87784167131066368") {
+		t.Fatalf("dm opt in was not saved: %+v", users)
+	}
+}
+
+func TestSave_KeepsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	useDatabase(t, path)
+	data := "#userid:username\n\n# officers\n1:Xackery #aka Xack\nnot a user\n2:Shin\n"
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	err = reload()
+	if err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+
+	err = SetDMEnabled("1", true)
+	if err != nil {
+		t.Fatalf("setDMEnabled: %s", err)
+	}
+	Set("3", "Rogean")
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	want := "#userid:username\n\n# officers\n1:Xackery:dm #aka Xack\nnot a user\n2:Shin\n3:Rogean\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+	matches, _ := filepath.Glob(path + ".*.tmp")
+	if len(matches) > 0 {
+		t.Fatalf("temporary files left behind: %v", matches)
+	}
+}